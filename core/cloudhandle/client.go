@@ -2,11 +2,17 @@ package cloudhandle
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 	"net/http"
+	"os"
 	"slices"
+	"strings"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
 	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
@@ -15,23 +21,56 @@ import (
 	"github.com/rs/zerolog"
 )
 
-var mediaTypes = []string{"image", "video", "audio", "document"}
-var validMessagesTypes = append([]string{"text"}, mediaTypes...)
+var mediaTypes = []string{"image", "video", "audio", "document", "sticker"}
+var validMessagesTypes = append([]string{
+	"text", "reaction", "location", "contacts", "interactive", "button",
+}, mediaTypes...)
 
-// Connect handles establishing the connection for the WhatsApp client.
-// Currently, this function is a stub and simply returns to satisfy the interface.
+// ErrPermanentFailure is wrapped by the errors of the webhook messages that would fail again if
+// they were retried, like the unsupported message types.
+var ErrPermanentFailure = errors.New("permanent failure")
+
+// errFileTooBig is returned when a media of WhatsApp is bigger than the maximum file size.
+var errFileTooBig = errors.New("the file is too big")
+
+// WithLastAttempt marks the context of the last attempt to handle a webhook, so the failures
+// that would otherwise be retried are reported in the portal.
+func WithLastAttempt(ctx context.Context) context.Context {
+	return context.WithValue(ctx, contextKeyLastAttempt, true)
+}
+
+// willRetry returns whether a webhook message that failed with the given error will be handled
+// again later.
+func willRetry(ctx context.Context, err error) bool {
+	lastAttempt, _ := ctx.Value(contextKeyLastAttempt).(bool)
+	return !lastAttempt && !errors.Is(err, ErrPermanentFailure)
+}
+
+// Connect starts checking the health of the login with the Graph API. The first check runs
+// right away and the next ones run on the configured interval.
 func (whatsappClient *WhatsappCloudClient) Connect(ctx context.Context) {
-	// Method to establish a connection to the whatsappClient.
-	// For now, we'll return nil to satisfy the interface.
-	return
+	whatsappClient.healthCheckLock.Lock()
+	defer whatsappClient.healthCheckLock.Unlock()
+
+	if whatsappClient.stopHealthCheck != nil {
+		whatsappClient.stopHealthCheck()
+	}
+
+	// The context of Connect can be canceled when it returns, so the checks use their own.
+	checkCtx, cancel := context.WithCancel(zerolog.Ctx(ctx).WithContext(context.Background()))
+	whatsappClient.stopHealthCheck = cancel
+	go whatsappClient.runHealthCheck(checkCtx)
 }
 
-// Disconnect handles terminating the connection for the WhatsApp client.
-// Currently, this function is a stub and simply returns to satisfy the interface.
+// Disconnect stops the health checks of the login.
 func (whatsappClient *WhatsappCloudClient) Disconnect() {
-	// Method to disconnect the whatsappClient.
-	// For now, we'll return nil to satisfy the interface.
-	return
+	whatsappClient.healthCheckLock.Lock()
+	defer whatsappClient.healthCheckLock.Unlock()
+
+	if whatsappClient.stopHealthCheck != nil {
+		whatsappClient.stopHealthCheck()
+		whatsappClient.stopHealthCheck = nil
+	}
 }
 
 // GetCapabilities returns the features and capabilities of a specific room (portal).
@@ -112,9 +151,10 @@ func (whatsappClient *WhatsappCloudClient) GetChatInfo(
 	return whatsappClient.getChatInfo(ctx, portal.ID)
 }
 
-// IsLoggedIn checks if the client is logged in and has an active connection.
+// IsLoggedIn checks if the client has a login whose access token wasn't rejected by the
+// Graph API.
 func (whatsappClient *WhatsappCloudClient) IsLoggedIn() bool {
-	return whatsappClient.UserLogin != nil && whatsappClient.UserLogin.Client.IsLoggedIn()
+	return whatsappClient.UserLogin != nil && !whatsappClient.badCredentials.Load()
 }
 
 // LogoutRemote handles logging out the user from the remote WhatsApp service.
@@ -126,34 +166,20 @@ func (whatsappClient *WhatsappCloudClient) LogoutRemote(ctx context.Context) {
 	whatsappClient.UserLogin.Client = nil
 }
 
-// HandleCloudMessage processes an incoming message from the WhatsApp Cloud API.
+// HandleCloudMessage processes the messages of a single change from the WhatsApp Cloud API.
 // It identifies the message type, converts it to an internal event, and queues it for processing.
 func (whatsappClient *WhatsappCloudClient) HandleCloudMessage(
-	ctx context.Context, event types.CloudEvent, portal *bridgev2.Portal,
+	ctx context.Context, value types.CloudValue, portal *bridgev2.Portal,
 ) error {
-	log := zerolog.Ctx(ctx).With().Str("HandleCloudMessage", event.Object).Logger()
-	log.Info().Msgf("Received Whatsapp Cloud message event: %s", event)
-
-	if len(event.Entry) > 1 {
-		log.Warn().Msg("Ignoring event because it contains multiple entries")
-		return fmt.Errorf("ignoring event because it contains multiple entries")
-	}
-
-	eventEntry := event.Entry[0]
-
-	if len(eventEntry.Changes) > 1 {
-		log.Warn().Msg("Ignoring event because it contains multiple changes")
-		return fmt.Errorf("ignoring event because it contains multiple changes")
-	}
+	log := zerolog.Ctx(ctx).With().Str("HandleCloudMessage", value.Metadata.PhoneNumberID).Logger()
+	log.Info().Interface("value", value).Msg("Received Whatsapp Cloud message event")
 
-	eventChange := eventEntry.Changes[0]
-
-	if eventChange.Value.Messages == nil || len(eventChange.Value.Messages) == 0 {
+	if len(value.Messages) == 0 {
 		log.Warn().Msg("Ignoring event because it contains no messages")
-		return fmt.Errorf("ignoring event because it contains no messages")
+		return fmt.Errorf("%w: ignoring event because it contains no messages", ErrPermanentFailure)
 	}
 
-	messages := eventChange.Value.Messages
+	messages := value.Messages
 
 	for _, messageData := range messages {
 		log.Info().Msgf(
@@ -163,7 +189,9 @@ func (whatsappClient *WhatsappCloudClient) HandleCloudMessage(
 
 		if messageData.ID == "" {
 			log.Warn().Msg("Ignoring event because the message data is empty")
-			return fmt.Errorf("ignoring event because the message data is empty")
+			return fmt.Errorf(
+				"%w: ignoring event because the message data is empty", ErrPermanentFailure,
+			)
 		}
 
 		messageType := messageData.Type
@@ -188,26 +216,62 @@ func (whatsappClient *WhatsappCloudClient) HandleCloudMessage(
 				Info:           messageInfo,
 				whatsappClient: whatsappClient,
 			},
-			Message:  eventChange.Value,
-			MsgEvent: event,
+			Message: value,
 		}
 
 		log.Error().Msgf("messageType: %v", messageType)
 
+		dedupeKind := dedupeKindMessage
+		if messageType == "reaction" {
+			dedupeKind = dedupeKindReaction
+		}
+
+		isNew, err := whatsappClient.claimCloudID(ctx, messageID, dedupeKind)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to check if the message was already processed")
+			return fmt.Errorf("failed to check if message %s was already processed: %w", messageID, err)
+		}
+
+		if !isNew {
+			log.Debug().Str("message_id", messageID).Msg("Ignoring message that was already processed")
+			continue
+		}
+
+		// Every customer message reopens the session window, even the unsupported ones. It's only
+		// recorded once, so the redeliveries of a message don't send the state again.
+		whatsappClient.recordCustomerMessage(ctx, portal, parseCloudTimestamp(messageData.TimeStamp))
+		whatsappClient.recordReferral(ctx, portal, messageData)
+
 		if !slices.Contains(validMessagesTypes, messageType) {
 			log.Warn().Msgf("Unsupported message type: %s", messageType)
-			return fmt.Errorf("unsupported message type: %s", messageType)
+			return fmt.Errorf("%w: unsupported message type: %s", ErrPermanentFailure, messageType)
 		}
 
 		log.Info().Msgf("Queued event for processing: %s", messageID)
 		switch {
-		case messageType == "text":
+		case messageType == "text", messageType == "location", messageType == "contacts",
+			messageType == "interactive", messageType == "button":
 			whatsappClient.QueueEvent(ctx, eventToQueue, messageData, portal)
 		case slices.Contains(mediaTypes, messageType):
-			whatsappClient.QueueMediaEvent(ctx, eventToQueue, messageData, portal)
+			err = whatsappClient.QueueMediaEvent(ctx, eventToQueue, messageData, portal)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to queue media")
+				whatsappClient.releaseCloudID(ctx, messageID, dedupeKind)
+				return err
+			}
+		case messageType == "reaction":
+			err = whatsappClient.QueueReactionEvent(ctx, eventToQueue, messageData, portal)
+			if err != nil {
+				log.Error().Err(err).Msg("Failed to queue reaction")
+				whatsappClient.releaseCloudID(ctx, messageID, dedupeKind)
+				return err
+			}
 		default:
 			log.Warn().Msgf("Ignoring unsupported message type: %s", messageType)
-			return fmt.Errorf("ignoring unsupported message type: %s", messageType)
+			whatsappClient.releaseCloudID(ctx, messageID, dedupeKind)
+			return fmt.Errorf(
+				"%w: ignoring unsupported message type: %s", ErrPermanentFailure, messageType,
+			)
 		}
 
 		log.Info().Msg("Successfully handled cloud message event")
@@ -218,128 +282,168 @@ func (whatsappClient *WhatsappCloudClient) HandleCloudMessage(
 	return nil
 }
 
-func (whatsappClient *WhatsappCloudClient) GetMediaFromMeta(ctx context.Context, mediaID string) ([]byte, error) {
-	log := whatsappClient.UserLogin.Log
+// GetMediaFromMeta gets the info of a media from the Graph API and starts downloading it.
+// The size is checked against the maximum file size before the download starts, and the caller
+// must close the returned body.
+func (whatsappClient *WhatsappCloudClient) GetMediaFromMeta(
+	ctx context.Context, mediaID string,
+) (*types.CloudMediaResponse, io.ReadCloser, error) {
+	log := zerolog.Ctx(ctx).With().Str("media_id", mediaID).Logger()
 
 	metaData := whatsappClient.GetMetaData(ctx)
 	if metaData == nil {
 		log.Error().Msg("User metadata not found")
-		return nil, fmt.Errorf("user metadata not found")
+		return nil, nil, fmt.Errorf("user metadata not found")
 	}
 
-	baseURL := *whatsappClient.Main.Config.WhatsApp.CloudURL
-	mediaURL := fmt.Sprintf("%s/%s?access_token=%s", baseURL, mediaID, metaData.PageAccessToken)
+	log.Info().Msg("Fetching media info from Meta")
 
-	log.Info().Str("media_url", mediaURL).Msg("Fetching media from Meta")
-
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaURL, nil)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create HTTP request")
-		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
-	}
-
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", metaData.PageAccessToken))
-
-	resp, err := http.DefaultClient.Do(req)
+	var mediaInfo types.CloudMediaResponse
+	err := whatsappClient.graphRequest(
+		ctx, http.MethodGet, whatsappClient.Main.GraphURL(mediaID), "", nil, &mediaInfo,
+	)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to fetch media from Meta")
-		return nil, fmt.Errorf("failed to fetch media from Meta: %w", err)
+		log.Error().Err(err).Msg("Failed to fetch media info from Meta")
+		return nil, nil, fmt.Errorf("failed to fetch media info from Meta: %w", err)
 	}
 
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		log.Error().Int("status_code", resp.StatusCode).Msg("Unexpected status code from Meta API")
-		return nil, fmt.Errorf("unexpected status code %d from Meta API", resp.StatusCode)
+	if mediaInfo.URL == "" {
+		return nil, nil, fmt.Errorf("the media info doesn't contain the media URL")
 	}
 
-	var mediaResponse MediaResponse
-	err = json.NewDecoder(resp.Body).Decode(&mediaResponse)
-
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to decode media response from Meta")
-		return nil, fmt.Errorf("failed to decode media response: %w", err)
-	}
-
-	if mediaResponse.Error != nil && *mediaResponse.Error != "" {
-		log.Error().Str("error", *mediaResponse.Error).Msg("Error in media response from Meta")
-		return nil, fmt.Errorf("Meta API error: %s", mediaResponse.Error)
+	maxFileSize := whatsappClient.Main.MsgConv.MaxFileSize
+	if maxFileSize > 0 && int64(mediaInfo.FileSize) > maxFileSize {
+		log.Warn().Int("media_size", mediaInfo.FileSize).Msg("Media is too big to be bridged")
+		return nil, nil, fmt.Errorf(
+			"%w (%s), the maximum size is %s", errFileTooBig,
+			formatFileSize(int64(mediaInfo.FileSize)), formatFileSize(maxFileSize),
+		)
 	}
 
-	mediaReq, err := http.NewRequestWithContext(ctx, http.MethodGet, *mediaResponse.URL, nil)
+	mediaReq, err := http.NewRequestWithContext(ctx, http.MethodGet, mediaInfo.URL, nil)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to create media content request")
-		return nil, fmt.Errorf("failed to create media content request: %w", err)
+		return nil, nil, fmt.Errorf("failed to create media content request: %w", err)
 	}
 
 	mediaReq.Header.Set("Authorization", fmt.Sprintf("Bearer %s", metaData.PageAccessToken))
 	mediaResp, err := http.DefaultClient.Do(mediaReq)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to fetch media content")
-		return nil, fmt.Errorf("failed to fetch media content: %w", err)
+		return nil, nil, fmt.Errorf("failed to fetch media content: %w", err)
 	}
 
 	if mediaResp.StatusCode < 200 || mediaResp.StatusCode >= 300 {
-		log.Error().Int("status_code", mediaResp.StatusCode).Msg("Unexpected status code from media URL")
-		return nil, fmt.Errorf("unexpected status code %d from media URL", mediaResp.StatusCode)
-	}
-
-	mediaData, err := io.ReadAll(mediaResp.Body)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to read media content")
-		return nil, fmt.Errorf("failed to read media content: %w", err)
+		defer mediaResp.Body.Close()
+		err = parseGraphError(mediaResp)
+		if isCredentialsError(err) {
+			whatsappClient.handleCredentialsError(ctx, err)
+		}
+		log.Error().Err(err).Msg("Failed to fetch media content")
+		return nil, nil, fmt.Errorf("failed to fetch media content: %w", err)
 	}
 
-	log.Info().Int("media_size", len(mediaData)).Msg("Media fetched from Meta successfully")
-	return mediaData, nil
+	return &mediaInfo, mediaResp.Body, nil
 }
 
-func (whatsappClient *WhatsappCloudClient) UploadMediaToSynapseV3(ctx context.Context, mediaData []byte, portal *bridgev2.Portal) (string, error) {
-	log := whatsappClient.UserLogin.Log
-
-	if len(mediaData) == 0 {
-		log.Error().Msg("Media data is empty, cannot upload to Synapse")
-		whatsappClient.sendMediaUploadFailedNotice(ctx, portal, "Media data is empty, cannot upload to Synapse")
-		return "", fmt.Errorf("Media data is empty")
+// UploadMediaToSynapseV3 streams a media from WhatsApp to the homeserver. Small files are kept in
+// memory and the rest go through a temp file, audios and videos always use a temp file so their
+// duration can be probed. The SHA256 of the media is verified if it's known.
+func (whatsappClient *WhatsappCloudClient) UploadMediaToSynapseV3(
+	ctx context.Context,
+	portal *bridgev2.Portal,
+	body io.Reader,
+	mediaInfo *types.CloudMediaResponse,
+	fileName string,
+	expectedSHA256 string,
+) (*preuploadedMedia, error) {
+	log := zerolog.Ctx(ctx).With().Str("media_id", mediaInfo.ID).Logger()
+
+	maxFileSize := whatsappClient.Main.MsgConv.MaxFileSize
+	if maxFileSize <= 0 {
+		maxFileSize = math.MaxInt64 - 1
 	}
 
-	intent := whatsappClient.Main.Bridge.Bot
-
-	contentType := "application/octet-stream"
-	if len(mediaData) >= 4 {
-		// Detect some common types by magic bytes
-		switch {
-		case mediaData[0] == 0xFF && mediaData[1] == 0xD8:
-			contentType = "image/jpeg"
-		case mediaData[0] == 0x89 && mediaData[1] == 0x50 && mediaData[2] == 0x4E && mediaData[3] == 0x47:
-			contentType = "image/png"
-		case mediaData[0] == 0x47 && mediaData[1] == 0x49 && mediaData[2] == 0x46:
-			contentType = "image/gif"
-		}
+	mimeType := mediaInfo.MimeType
+	if mimeType == "" {
+		mimeType = "application/octet-stream"
 	}
 
-	mxcURL, _, err := intent.UploadMedia(ctx, portal.MXID, mediaData, fmt.Sprintf("whatsapp-media-%d", len(mediaData)), contentType)
+	probeDuration := strings.HasPrefix(mimeType, "audio/") || strings.HasPrefix(mimeType, "video/")
+	uploadedMedia := &preuploadedMedia{MimeType: mimeType}
+
+	var err error
+	intent := whatsappClient.Main.Bridge.Bot
+	uploadedMedia.MXC, uploadedMedia.File, err = intent.UploadMediaStream(
+		ctx, portal.MXID, int64(mediaInfo.FileSize), probeDuration,
+		func(file io.Writer) (*bridgev2.FileStreamResult, error) {
+			hasher := sha256.New()
+			// Read one byte over the limit to know if the media is bigger than allowed.
+			size, err := io.Copy(
+				io.MultiWriter(file, hasher), io.LimitReader(body, maxFileSize+1),
+			)
+			if err != nil {
+				return nil, fmt.Errorf("failed to download media: %w", err)
+			}
+
+			if size == 0 {
+				return nil, fmt.Errorf("media data is empty")
+			}
+
+			if size > maxFileSize {
+				return nil, fmt.Errorf(
+					"%w, the maximum size is %s", errFileTooBig, formatFileSize(maxFileSize),
+				)
+			}
+
+			if !verifyMediaHash(hasher.Sum(nil), expectedSHA256) {
+				return nil, fmt.Errorf("the SHA256 of the media doesn't match the expected one")
+			}
+
+			uploadedMedia.Size = int(size)
+			if osFile, ok := file.(*os.File); ok && probeDuration {
+				uploadedMedia.Duration = probeFileDuration(ctx, osFile.Name())
+			}
+
+			return &bridgev2.FileStreamResult{
+				FileName: fileName,
+				MimeType: mimeType,
+			}, nil
+		},
+	)
 	if err != nil {
 		log.Error().Err(err).Msg("Failed to upload media to Matrix")
-		whatsappClient.sendMediaUploadFailedNotice(ctx, portal, fmt.Sprintf("Failed to upload media, error: %v", err))
-		return "", fmt.Errorf("failed to upload media to Matrix: %w", err)
+		errorMessage := err.Error()
+		err = fmt.Errorf("failed to upload media to Matrix: %w", err)
+		if errors.Is(err, errFileTooBig) {
+			err = fmt.Errorf("%w: %w", ErrPermanentFailure, err)
+		}
+		// The notice is only sent once, not on every attempt to handle the message.
+		if !willRetry(ctx, err) {
+			whatsappClient.sendMediaUploadFailedNotice(ctx, portal, errorMessage)
+		}
+		return nil, err
 	}
 
-	log.Info().Int("media_size", len(mediaData)).Str("mxc_url", string(mxcURL)).Msg("Media uploaded to Synapse successfully")
-	return string(mxcURL), nil
+	log.Info().Int("media_size", uploadedMedia.Size).Str("mxc_url", string(uploadedMedia.MXC)).
+		Msg("Media uploaded to Synapse successfully")
+	return uploadedMedia, nil
 }
 
-func (whatsappClient *WhatsappCloudClient) sendMediaUploadFailedNotice(ctx context.Context, portal *bridgev2.Portal, errorMessage string) {
-	log := whatsappClient.UserLogin.Log
-
-	content := &event.Content{
-		Parsed: &event.MessageEventContent{
-			MsgType: event.MsgNotice,
-			Body:    fmt.Sprintf("Failed to upload media from WhatsApp: %s", errorMessage),
-		},
+// verifyMediaHash checks the hash of the downloaded media against the SHA256 sent by Meta, which
+// can be encoded in hex or base64. An empty expected hash can't be verified and is accepted.
+func verifyMediaHash(hash []byte, expectedSHA256 string) bool {
+	if expectedSHA256 == "" {
+		return true
 	}
 
-	intent := whatsappClient.Main.Bridge.Bot
-	_, err := intent.SendMessage(ctx, portal.MXID, event.EventMessage, content, nil)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to send media upload failure notice to portal")
-	}
+	return strings.EqualFold(hex.EncodeToString(hash), expectedSHA256) ||
+		base64.StdEncoding.EncodeToString(hash) == expectedSHA256 ||
+		base64.RawURLEncoding.EncodeToString(hash) == strings.TrimRight(expectedSHA256, "=")
+}
+
+func (whatsappClient *WhatsappCloudClient) sendMediaUploadFailedNotice(ctx context.Context, portal *bridgev2.Portal, errorMessage string) {
+	whatsappClient.sendPortalNotice(
+		ctx, portal, fmt.Sprintf("Failed to upload media from WhatsApp: %s", errorMessage),
+	)
 }
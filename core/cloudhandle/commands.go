@@ -0,0 +1,447 @@
+package cloudhandle
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/commands"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/database"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+)
+
+var supportedLanguages = []string{"en", "es"}
+
+var helpSectionCloud = commands.HelpSection{Name: "WhatsApp Cloud", Order: 15}
+
+var cmdLanguage = &commands.FullHandler{
+	Func: fnLanguage,
+	Name: "language",
+	Help: commands.HelpMeta{
+		Section:     helpSectionCloud,
+		Description: "Set the language of the notices sent to this portal",
+		Args:        "<_en|es|default_>",
+	},
+	RequiresPortal: true,
+}
+
+// fnLanguage sets the language of the notices of the portal. Using `default` removes the
+// language of the portal, so the language of the app is used again.
+func fnLanguage(ce *commands.Event) {
+	if len(ce.Args) != 1 {
+		ce.Reply("**Usage:** `$cmdprefix language <en|es|default>`")
+		return
+	}
+
+	language := strings.ToLower(ce.Args[0])
+	if language == "default" {
+		language = ""
+	} else if !slices.Contains(supportedLanguages, language) {
+		ce.Reply(
+			"Unsupported language, the supported languages are: %s",
+			strings.Join(supportedLanguages, ", "),
+		)
+		return
+	}
+
+	metadata := ce.Portal.Metadata.(*waid.PortalMetadata)
+	metadata.Language = language
+
+	err := ce.Portal.Save(ce.Ctx)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to save portal language")
+		ce.Reply("Failed to save the language of the portal")
+		return
+	}
+
+	if language == "" {
+		ce.Reply("The notices of this portal will use the language of the app")
+		return
+	}
+	ce.Reply("The notices of this portal will be sent in `%s`", language)
+}
+
+var cmdTemplate = &commands.FullHandler{
+	Func: fnTemplate,
+	Name: "template",
+	Help: commands.HelpMeta{
+		Section:     helpSectionCloud,
+		Description: "Manage the message templates of the WhatsApp Business Account",
+		Args:        "<_list|sync|create|edit|delete|send_> [_args..._]",
+	},
+	RequiresLogin: true,
+}
+
+const templateUsage = "**Usage:**\n" +
+	"* `$cmdprefix template list`\n" +
+	"* `$cmdprefix template sync`\n" +
+	"* `$cmdprefix template create <name> <language> <category> <body>`\n" +
+	"* `$cmdprefix template edit <name> <language> <body>`\n" +
+	"* `$cmdprefix template delete <name>`\n" +
+	"* `$cmdprefix template send <name> <language> [params...]` (in a portal)"
+
+// fnTemplate lists, syncs, creates, edits and deletes the message templates of the default
+// login of the user. The templates created with this command only have a body component.
+// Templates can also be sent to the WhatsApp user of the current portal.
+func fnTemplate(ce *commands.Event) {
+	if len(ce.Args) == 0 {
+		ce.Reply(templateUsage)
+		return
+	}
+
+	login := ce.User.GetDefaultLogin()
+	whatsappClient, ok := login.Client.(*WhatsappCloudClient)
+	if !ok {
+		ce.Reply("The WhatsApp Cloud client of your login isn't loaded")
+		return
+	}
+
+	args := ce.Args[1:]
+	switch strings.ToLower(ce.Args[0]) {
+	case "list":
+		templates, err := whatsappClient.GetTemplates(ce.Ctx)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to get message templates")
+			ce.Reply("Failed to get the message templates: %v", err)
+			return
+		}
+
+		if len(templates) == 0 {
+			ce.Reply("There are no message templates")
+			return
+		}
+
+		lines := make([]string, 0, len(templates))
+		for _, template := range templates {
+			line := fmt.Sprintf(
+				"* `%s` (%s) - %s - **%s**",
+				template.Name, template.Language, template.Category, template.Status,
+			)
+			if template.RejectedReason != "" {
+				line += fmt.Sprintf(" (%s)", template.RejectedReason)
+			}
+			lines = append(lines, line)
+		}
+		ce.Reply(strings.Join(lines, "\n"))
+
+	case "sync":
+		templates, err := whatsappClient.SyncTemplates(ce.Ctx)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to sync message templates")
+			ce.Reply("Failed to sync the message templates: %v", err)
+			return
+		}
+		ce.Reply("Synced %d message templates", len(templates))
+
+	case "create":
+		if len(args) < 4 {
+			ce.Reply(templateUsage)
+			return
+		}
+
+		template, err := whatsappClient.CreateTemplate(ce.Ctx, types.CloudTemplate{
+			Name:     args[0],
+			Language: args[1],
+			Category: args[2],
+			Components: []types.CloudTemplateComponent{
+				{Type: "BODY", Text: strings.Join(args[3:], " ")},
+			},
+		})
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to create message template")
+			ce.Reply("Failed to create the message template: %v", err)
+			return
+		}
+		ce.Reply("Template `%s` created with status **%s**", template.Name, template.Status)
+
+	case "edit":
+		if len(args) < 3 {
+			ce.Reply(templateUsage)
+			return
+		}
+
+		template, err := whatsappClient.Main.DB.Template.GetByNameAndLanguage(
+			ce.Ctx, whatsappClient.GetMetaData(ce.Ctx).WabaID, args[0], args[1],
+		)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to get message template")
+			ce.Reply("Failed to get the message template: %v", err)
+			return
+		} else if template == nil {
+			ce.Reply("Template `%s` (%s) not found, try `$cmdprefix template sync`", args[0], args[1])
+			return
+		}
+
+		// Only the body is replaced, the other components of the template are kept.
+		body := strings.Join(args[2:], " ")
+		components := make([]types.CloudTemplateComponent, 0, len(template.Components)+1)
+		hasBody := false
+		for _, component := range template.Components {
+			if strings.EqualFold(component.Type, "BODY") {
+				component.Text = body
+				component.Example = nil
+				hasBody = true
+			}
+			components = append(components, component)
+		}
+		if !hasBody {
+			components = append(components, types.CloudTemplateComponent{Type: "BODY", Text: body})
+		}
+
+		_, err = whatsappClient.EditTemplate(
+			ce.Ctx, template.TemplateID, types.CloudTemplateEditRequest{Components: components},
+		)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to edit message template")
+			ce.Reply("Failed to edit the message template: %v", err)
+			return
+		}
+		ce.Reply("Template `%s` edited, it will be reviewed again", args[0])
+
+	case "delete":
+		if len(args) != 1 {
+			ce.Reply(templateUsage)
+			return
+		}
+
+		err := whatsappClient.DeleteTemplate(ce.Ctx, args[0])
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to delete message template")
+			ce.Reply("Failed to delete the message template: %v", err)
+			return
+		}
+		ce.Reply("Template `%s` deleted", args[0])
+
+	case "send":
+		if len(args) < 2 {
+			ce.Reply(templateUsage)
+			return
+		} else if ce.Portal == nil {
+			ce.Reply("Templates can only be sent from a portal")
+			return
+		}
+
+		sendTemplateCommand(ce, whatsappClient, &types.CloudTemplateMessage{
+			Name:       args[0],
+			Language:   args[1],
+			Parameters: args[2:],
+		})
+
+	default:
+		ce.Reply(templateUsage)
+	}
+}
+
+// sendTemplateCommand sends a template to the WhatsApp user of the portal and posts its rendered
+// text into the room, so it's shown as the bridged outbound message.
+func sendTemplateCommand(
+	ce *commands.Event,
+	whatsappClient *WhatsappCloudClient,
+	templateMessage *types.CloudTemplateMessage,
+) {
+	messageID, renderedText, err := whatsappClient.SendTemplate(
+		ce.Ctx, ce.Portal, templateMessage, "",
+	)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send template")
+		var graphError *types.GraphError
+		if errors.As(err, &graphError) {
+			whatsappClient.sendErrorNotice(
+				ce.Ctx, ce.Portal, graphError.Code, graphError.Title(), graphError.Details(),
+			)
+			return
+		}
+		ce.Reply("Failed to send the template: %v", err)
+		return
+	}
+
+	showSentMessage(ce, whatsappClient, messageID, &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgText,
+			Body:    renderedText,
+		},
+		Raw: map[string]any{
+			TemplateContentKey: templateMessage,
+		},
+	})
+}
+
+// showSentMessage posts a message sent to WhatsApp by a command into the room and saves it like
+// the ones sent from Matrix, so its statuses are bridged.
+func showSentMessage(
+	ce *commands.Event,
+	whatsappClient *WhatsappCloudClient,
+	messageID string,
+	content *event.Content,
+) {
+	chatJID, err := waid.ParsePortalID(ce.Portal.ID)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to parse portal ID")
+		return
+	}
+
+	bot := whatsappClient.Main.Bridge.Bot
+	resp, err := bot.SendMessage(ce.Ctx, ce.Portal.MXID, event.EventMessage, content, nil)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send message to room")
+		ce.Reply("The message was sent, but it couldn't be shown in the room")
+		return
+	}
+
+	err = whatsappClient.Main.Bridge.DB.Message.Insert(ce.Ctx, &database.Message{
+		ID:         waid.MakeMessageID(chatJID, string(whatsappClient.UserLogin.ID), messageID),
+		MXID:       resp.EventID,
+		Room:       ce.Portal.PortalKey,
+		SenderID:   networkid.UserID(ce.User.MXID),
+		SenderMXID: bot.GetMXID(),
+		Timestamp:  time.Now(),
+		Metadata:   &waid.MessageMetadata{},
+	})
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to save sent message")
+	}
+}
+
+var cmdReengagement = &commands.FullHandler{
+	Func: fnReengagement,
+	Name: "reengagement",
+	Help: commands.HelpMeta{
+		Section:     helpSectionCloud,
+		Description: "Set the template sent when the 24-hour customer service window is closed",
+		Args:        "[_<name> <language>|off_]",
+	},
+	RequiresLogin: true,
+}
+
+// fnReengagement shows or changes the re-engagement template of the app of the default login.
+func fnReengagement(ce *commands.Event) {
+	login := ce.User.GetDefaultLogin()
+	whatsappClient, ok := login.Client.(*WhatsappCloudClient)
+	if !ok {
+		ce.Reply("The WhatsApp Cloud client of your login isn't loaded")
+		return
+	}
+
+	if len(ce.Args) == 0 {
+		app, err := whatsappClient.getApp(ce.Ctx)
+		if err != nil {
+			ce.Log.Err(err).Msg("Failed to get app")
+			ce.Reply("Failed to get the app: %v", err)
+		} else if app == nil || app.ReengagementTemplate == "" {
+			ce.Reply("There is no re-engagement template")
+		} else {
+			ce.Reply(
+				"The re-engagement template is `%s` (%s)",
+				app.ReengagementTemplate, app.ReengagementLanguage,
+			)
+		}
+		return
+	}
+
+	var name, language string
+	if len(ce.Args) == 2 {
+		name, language = ce.Args[0], ce.Args[1]
+		_, err := whatsappClient.getSendableTemplate(ce.Ctx, name, language)
+		if err != nil {
+			ce.Reply("Can't use the template as re-engagement template: %v", err)
+			return
+		}
+	} else if len(ce.Args) != 1 || strings.ToLower(ce.Args[0]) != "off" {
+		ce.Reply("**Usage:** `$cmdprefix reengagement [<name> <language>|off]`")
+		return
+	}
+
+	err := whatsappClient.Main.DB.CloudRequest.SetReengagementTemplate(
+		ce.Ctx, string(login.ID), name, language,
+	)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to save re-engagement template")
+		ce.Reply("Failed to save the re-engagement template")
+		return
+	}
+
+	if name == "" {
+		ce.Reply("The re-engagement template was disabled")
+		return
+	}
+	ce.Reply("The re-engagement template is now `%s` (%s)", name, language)
+}
+
+var cmdContact = &commands.FullHandler{
+	Func: fnContact,
+	Name: "contact",
+	Help: commands.HelpMeta{
+		Section:     helpSectionCloud,
+		Description: "Send a contact to the WhatsApp user of this portal",
+		Args:        "<_name_> | <_phone_> [| <_email_>] [| <_organization_>]",
+	},
+	RequiresLogin:  true,
+	RequiresPortal: true,
+}
+
+// fnContact sends a contact built from the fields of the command. The fields are separated by
+// pipes, because names and organizations usually have spaces.
+func fnContact(ce *commands.Event) {
+	fields := strings.Split(ce.RawArgs, "|")
+	for i, field := range fields {
+		fields[i] = strings.TrimSpace(field)
+	}
+
+	if len(fields) < 2 || len(fields) > 4 || fields[0] == "" || fields[1] == "" {
+		ce.Reply(
+			"**Usage:** `$cmdprefix contact <name> | <phone> [| <email>] [| <organization>]`",
+		)
+		return
+	}
+
+	login := ce.User.GetDefaultLogin()
+	whatsappClient, ok := login.Client.(*WhatsappCloudClient)
+	if !ok {
+		ce.Reply("The WhatsApp Cloud client of your login isn't loaded")
+		return
+	}
+
+	card := types.CloudContactCard{
+		Name:   types.CloudContactName{FormattedName: fields[0]},
+		Phones: []types.CloudContactPhone{{Phone: fields[1]}},
+	}
+	firstName, lastName, _ := strings.Cut(fields[0], " ")
+	card.Name.FirstName = firstName
+	card.Name.LastName = strings.TrimSpace(lastName)
+	if len(fields) > 2 && fields[2] != "" {
+		card.Emails = []types.CloudContactEmail{{Email: fields[2]}}
+	}
+	if len(fields) > 3 && fields[3] != "" {
+		card.Org = &types.CloudContactOrg{Company: fields[3]}
+	}
+	cards := []types.CloudContactCard{card}
+
+	messageID, err := whatsappClient.SendContacts(ce.Ctx, ce.Portal, cards)
+	if err != nil {
+		ce.Log.Err(err).Msg("Failed to send contact")
+		var graphError *types.GraphError
+		if errors.As(err, &graphError) {
+			whatsappClient.sendErrorNotice(
+				ce.Ctx, ce.Portal, graphError.Code, graphError.Title(), graphError.Details(),
+			)
+			return
+		}
+		ce.Reply("Failed to send the contact: %v", err)
+		return
+	}
+
+	content, err := uploadContactsFile(ce.Ctx, whatsappClient.Main.Bridge.Bot, ce.Portal, cards)
+	if err != nil {
+		ce.Log.Warn().Err(err).Msg("Failed to upload vCard of sent contact")
+		content = &event.MessageEventContent{
+			MsgType: event.MsgText,
+			Body:    formatContactsSummary(cards),
+		}
+	}
+	showSentMessage(ce, whatsappClient, messageID, &event.Content{Parsed: content})
+}
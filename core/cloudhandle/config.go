@@ -41,6 +41,29 @@ type ErrorCode struct {
 
 type errorCodes map[int]ErrorCode
 
+// Reason returns the reason of the error code in the given language, falling back to english.
+func (code ErrorCode) Reason(language string) *string {
+	if language == "es" && code.ReasonEs != nil {
+		return code.ReasonEs
+	}
+	return code.ReasonEn
+}
+
+type WebhookQueueConfig struct {
+	Workers       int `yaml:"workers"`
+	MaxAttempts   int `yaml:"max_attempts"`
+	RetryDelay    int `yaml:"retry_delay"`
+	MaxRetryDelay int `yaml:"max_retry_delay"`
+	PollInterval  int `yaml:"poll_interval"`
+	LockTimeout   int `yaml:"lock_timeout"`
+}
+
+// AppSettingsConfig overrides the settings of the bridge for a single app.
+type AppSettingsConfig struct {
+	SendReadReceipts *bool `yaml:"send_read_receipts"`
+	SendTyping       *bool `yaml:"send_typing"`
+}
+
 type WhatsappCloudConfig struct {
 	CloudURL          *string     `yaml:"base_url"`
 	CloudVersion      *string     `yaml:"version"`
@@ -48,6 +71,20 @@ type WhatsappCloudConfig struct {
 	CloudTemplatePath *string     `yaml:"template_path"`
 	CloudFileName     *string     `yaml:"file_name"`
 	CloudErrorCodes   *errorCodes `yaml:"error_codes"`
+	CloudAppSecret    *string     `yaml:"app_secret"`
+	CloudVerifyToken  *string     `yaml:"verify_token"`
+	CloudLanguage     *string     `yaml:"default_language"`
+
+	CloudDedupeRetention *int                `yaml:"dedupe_retention"`
+	CloudWebhookQueue    *WebhookQueueConfig `yaml:"webhook_queue"`
+
+	CloudStaticMapURL *string `yaml:"static_map_url"`
+
+	CloudSendReadReceipts *bool                        `yaml:"send_read_receipts"`
+	CloudSendTyping       *bool                        `yaml:"send_typing"`
+	CloudAppSettings      map[string]AppSettingsConfig `yaml:"app_settings"`
+
+	CloudHealthCheckInterval *int `yaml:"health_check_interval"`
 }
 
 type Config struct {
@@ -95,8 +132,23 @@ func upgradeConfig(helper up.Helper) {
 	helper.Copy(up.Str, "whatsapp", "base_url")
 	helper.Copy(up.Str, "whatsapp", "version")
 	helper.Copy(up.Str, "whatsapp", "webhook_path")
-	helper.Copy(up.Str, "whatsapp", "error_codes")
+	helper.Copy(up.Map, "whatsapp", "error_codes")
 	helper.Copy(up.Str, "whatsapp", "file_name")
+	helper.Copy(up.Str, "whatsapp", "app_secret")
+	helper.Copy(up.Str, "whatsapp", "verify_token")
+	helper.Copy(up.Str, "whatsapp", "default_language")
+	helper.Copy(up.Int, "whatsapp", "dedupe_retention")
+	helper.Copy(up.Int, "whatsapp", "webhook_queue", "workers")
+	helper.Copy(up.Int, "whatsapp", "webhook_queue", "max_attempts")
+	helper.Copy(up.Int, "whatsapp", "webhook_queue", "retry_delay")
+	helper.Copy(up.Int, "whatsapp", "webhook_queue", "max_retry_delay")
+	helper.Copy(up.Int, "whatsapp", "webhook_queue", "poll_interval")
+	helper.Copy(up.Int, "whatsapp", "webhook_queue", "lock_timeout")
+	helper.Copy(up.Str, "whatsapp", "static_map_url")
+	helper.Copy(up.Bool, "whatsapp", "send_read_receipts")
+	helper.Copy(up.Bool, "whatsapp", "send_typing")
+	helper.Copy(up.Map, "whatsapp", "app_settings")
+	helper.Copy(up.Int, "whatsapp", "health_check_interval")
 }
 
 type DisplaynameParams struct {
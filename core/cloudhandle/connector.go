@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/commands"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
 	"go.mau.fi/util/exsync"
@@ -53,6 +54,13 @@ func (whatsappConnector *WhatsappCloudConnector) Init(bridge *bridgev2.Bridge) {
 		bridge.Log.With().Str("db_section", "whatsappcloud").Logger(),
 	)
 	whatsappConnector.MsgConv.DB = whatsappConnector.DB
+
+	whatsappConnector.Bridge.Commands.(*commands.Processor).AddHandlers(
+		cmdLanguage,
+		cmdTemplate,
+		cmdReengagement,
+		cmdContact,
+	)
 }
 
 // Start begins the connector's operation, which includes performing database schema upgrades.
@@ -62,6 +70,10 @@ func (whatsappConnector *WhatsappCloudConnector) Start(ctx context.Context) erro
 		return bridgev2.DBUpgradeError{Err: err, Section: "whatsappcloud"}
 	}
 
+	go whatsappConnector.pruneProcessedMessages(
+		whatsappConnector.Bridge.Log.WithContext(whatsappConnector.Bridge.BackgroundCtx),
+	)
+
 	return nil
 }
 
@@ -0,0 +1,466 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime/quotedprintable"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+// vCardMimeTypes are the mime types used by the vCard files sent from Matrix clients.
+var vCardMimeTypes = []string{"text/vcard", "text/x-vcard", "text/directory"}
+
+// maxVCardSize is the maximum size of the vCard files that are converted into contacts.
+const maxVCardSize = 1024 * 1024
+
+var vCardFileNameRegex = regexp.MustCompile(`[^\p{L}\p{N} ._-]+`)
+
+// escapeVCardValue escapes the special characters of a vCard value.
+func escapeVCardValue(value string) string {
+	return strings.NewReplacer(
+		`\`, `\\`, "\n", `\n`, ",", `\,`, ";", `\;`,
+	).Replace(value)
+}
+
+// splitVCardValue splits a structured vCard value on its unescaped semicolons and unescapes
+// every component.
+func splitVCardValue(value string) []string {
+	var components []string
+	var current strings.Builder
+
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value):
+			i++
+			if value[i] == 'n' || value[i] == 'N' {
+				current.WriteByte('\n')
+			} else {
+				current.WriteByte(value[i])
+			}
+		case value[i] == ';':
+			components = append(components, current.String())
+			current.Reset()
+		default:
+			current.WriteByte(value[i])
+		}
+	}
+
+	return append(components, current.String())
+}
+
+// decodeQuotedPrintable decodes a vCard 2.1 value encoded as quoted-printable, like the names
+// exported by Android. The value is returned as is if it isn't valid.
+func decodeQuotedPrintable(value string) string {
+	decoded, err := io.ReadAll(quotedprintable.NewReader(strings.NewReader(value)))
+	if err != nil {
+		return value
+	}
+	return string(decoded)
+}
+
+// unfoldVCard joins the lines of a vCard that were split to keep them short. Long lines are
+// folded by starting the next line with a space or a tab, and quoted-printable values are
+// continued on the next line when they end with an equals sign.
+func unfoldVCard(data []byte) []string {
+	text := strings.ReplaceAll(string(data), "\r\n", "\n")
+	text = strings.NewReplacer("\n ", "", "\n\t", "").Replace(text)
+
+	var lines []string
+	continued := false
+	for _, line := range strings.Split(text, "\n") {
+		if continued {
+			lines[len(lines)-1] = strings.TrimSuffix(lines[len(lines)-1], "=") + line
+		} else {
+			lines = append(lines, line)
+		}
+
+		current := lines[len(lines)-1]
+		property, _, _ := strings.Cut(current, ":")
+		continued = strings.Contains(strings.ToUpper(property), "QUOTED-PRINTABLE") &&
+			strings.HasSuffix(current, "=")
+	}
+
+	return lines
+}
+
+// vCardComponent returns the component of a structured vCard value, or "" if it's missing.
+func vCardComponent(components []string, index int) string {
+	if index >= len(components) {
+		return ""
+	}
+	return strings.TrimSpace(components[index])
+}
+
+// vCardType returns the first meaningful type of a vCard property, like CELL or WORK.
+func vCardType(params map[string][]string) string {
+	for _, value := range params["TYPE"] {
+		value = strings.ToUpper(value)
+		if value != "PREF" && value != "VOICE" && value != "INTERNET" {
+			return value
+		}
+	}
+	return ""
+}
+
+// parseVCardLine splits a vCard line into its property name, parameters and value.
+func parseVCardLine(line string) (string, map[string][]string, string, bool) {
+	property, value, found := strings.Cut(line, ":")
+	if !found {
+		return "", nil, "", false
+	}
+
+	parts := strings.Split(property, ";")
+	name := strings.ToUpper(parts[0])
+	// Grouped properties, like item1.TEL, are used by some phones.
+	if _, groupedName, grouped := strings.Cut(name, "."); grouped {
+		name = groupedName
+	}
+
+	params := map[string][]string{}
+	for _, param := range parts[1:] {
+		key, paramValue, hasValue := strings.Cut(param, "=")
+		if !hasValue {
+			// vCard 2.1 parameters don't have a name, like TEL;CELL.
+			key, paramValue = "TYPE", param
+		}
+		key = strings.ToUpper(key)
+		for _, item := range strings.Split(strings.Trim(paramValue, `"`), ",") {
+			params[key] = append(params[key], item)
+		}
+	}
+
+	return name, params, value, true
+}
+
+// parseVCard converts the cards of a vCard file into WhatsApp Cloud contacts.
+func parseVCard(data []byte) ([]types.CloudContactCard, error) {
+	var cards []types.CloudContactCard
+	var card *types.CloudContactCard
+
+	for _, line := range unfoldVCard(data) {
+		name, params, value, ok := parseVCardLine(strings.TrimSpace(line))
+		if !ok {
+			continue
+		}
+
+		if name == "BEGIN" && strings.EqualFold(value, "VCARD") {
+			card = &types.CloudContactCard{}
+			continue
+		} else if card == nil {
+			continue
+		}
+
+		components := splitVCardValue(value)
+		for _, encoding := range params["ENCODING"] {
+			if strings.EqualFold(encoding, "QUOTED-PRINTABLE") {
+				for i := range components {
+					components[i] = decodeQuotedPrintable(components[i])
+				}
+			}
+		}
+
+		switch name {
+		case "END":
+			if card.Name.FormattedName == "" {
+				card.Name.FormattedName = strings.TrimSpace(
+					strings.Join([]string{card.Name.FirstName, card.Name.LastName}, " "),
+				)
+			}
+			if card.Name.FormattedName == "" && len(card.Phones) > 0 {
+				card.Name.FormattedName = card.Phones[0].Phone
+			}
+			if card.Name.FormattedName != "" {
+				cards = append(cards, *card)
+			}
+			card = nil
+		case "FN":
+			card.Name.FormattedName = vCardComponent(components, 0)
+		case "N":
+			card.Name.LastName = vCardComponent(components, 0)
+			card.Name.FirstName = vCardComponent(components, 1)
+			card.Name.MiddleName = vCardComponent(components, 2)
+			card.Name.Prefix = vCardComponent(components, 3)
+			card.Name.Suffix = vCardComponent(components, 4)
+		case "TEL":
+			phone := types.CloudContactPhone{
+				Phone: strings.TrimPrefix(vCardComponent(components, 0), "tel:"),
+				Type:  vCardType(params),
+			}
+			if waID := params["WAID"]; len(waID) > 0 {
+				phone.WaID = waID[0]
+			}
+			if phone.Phone != "" {
+				card.Phones = append(card.Phones, phone)
+			}
+		case "EMAIL":
+			email := vCardComponent(components, 0)
+			if email != "" {
+				card.Emails = append(card.Emails, types.CloudContactEmail{
+					Email: email,
+					Type:  vCardType(params),
+				})
+			}
+		case "ORG":
+			if card.Org == nil {
+				card.Org = &types.CloudContactOrg{}
+			}
+			card.Org.Company = vCardComponent(components, 0)
+			card.Org.Department = vCardComponent(components, 1)
+		case "TITLE":
+			if card.Org == nil {
+				card.Org = &types.CloudContactOrg{}
+			}
+			card.Org.Title = vCardComponent(components, 0)
+		case "ADR":
+			card.Addresses = append(card.Addresses, types.CloudContactAddress{
+				Street:  vCardComponent(components, 2),
+				City:    vCardComponent(components, 3),
+				State:   vCardComponent(components, 4),
+				Zip:     vCardComponent(components, 5),
+				Country: vCardComponent(components, 6),
+				Type:    vCardType(params),
+			})
+		case "URL":
+			url := strings.TrimSpace(strings.Join(components, ";"))
+			if url != "" {
+				card.URLs = append(card.URLs, types.CloudContactURL{
+					URL:  url,
+					Type: vCardType(params),
+				})
+			}
+		case "BDAY":
+			birthday := vCardComponent(components, 0)
+			// WhatsApp only accepts birthdays in the YYYY-MM-DD format.
+			if len(birthday) == 8 && !strings.Contains(birthday, "-") {
+				birthday = birthday[:4] + "-" + birthday[4:6] + "-" + birthday[6:]
+			}
+			card.Birthday = birthday
+		}
+	}
+
+	if len(cards) == 0 {
+		return nil, fmt.Errorf("the vCard doesn't contain any contact")
+	}
+
+	return cards, nil
+}
+
+// buildVCard converts WhatsApp Cloud contacts into a vCard file.
+func buildVCard(cards []types.CloudContactCard) []byte {
+	var vCard strings.Builder
+	writeLine := func(property string, values ...string) {
+		for i, value := range values {
+			values[i] = escapeVCardValue(value)
+		}
+		vCard.WriteString(property + ":" + strings.Join(values, ";") + "\r\n")
+	}
+	withType := func(property string, cardType string) string {
+		if cardType == "" {
+			return property
+		}
+		return property + ";TYPE=" + cardType
+	}
+
+	for _, card := range cards {
+		writeLine("BEGIN", "VCARD")
+		writeLine("VERSION", "3.0")
+		writeLine("FN", card.Name.FormattedName)
+		writeLine(
+			"N", card.Name.LastName, card.Name.FirstName, card.Name.MiddleName,
+			card.Name.Prefix, card.Name.Suffix,
+		)
+
+		if card.Org != nil {
+			if card.Org.Company != "" || card.Org.Department != "" {
+				writeLine("ORG", card.Org.Company, card.Org.Department)
+			}
+			if card.Org.Title != "" {
+				writeLine("TITLE", card.Org.Title)
+			}
+		}
+
+		for _, phone := range card.Phones {
+			property := withType("TEL", phone.Type)
+			if phone.WaID != "" {
+				property += ";waid=" + phone.WaID
+			}
+			writeLine(property, phone.Phone)
+		}
+		for _, email := range card.Emails {
+			writeLine(withType("EMAIL", email.Type), email.Email)
+		}
+		for _, address := range card.Addresses {
+			writeLine(
+				withType("ADR", address.Type), "", "", address.Street, address.City,
+				address.State, address.Zip, address.Country,
+			)
+		}
+		for _, url := range card.URLs {
+			writeLine(withType("URL", url.Type), url.URL)
+		}
+		if card.Birthday != "" {
+			writeLine("BDAY", card.Birthday)
+		}
+
+		writeLine("END", "VCARD")
+	}
+
+	return []byte(vCard.String())
+}
+
+// formatContactsSummary builds the readable text of the contacts shown in Matrix.
+func formatContactsSummary(cards []types.CloudContactCard) string {
+	summaries := make([]string, 0, len(cards))
+	for _, card := range cards {
+		lines := []string{"Contact: " + card.Name.FormattedName}
+
+		for _, phone := range card.Phones {
+			line := "Phone: " + phone.Phone
+			if phone.Type != "" {
+				line += fmt.Sprintf(" (%s)", strings.ToLower(phone.Type))
+			}
+			lines = append(lines, line)
+		}
+		for _, email := range card.Emails {
+			lines = append(lines, "Email: "+email.Email)
+		}
+		if card.Org != nil {
+			var org []string
+			for _, field := range []string{card.Org.Company, card.Org.Department, card.Org.Title} {
+				if field != "" {
+					org = append(org, field)
+				}
+			}
+			if len(org) > 0 {
+				lines = append(lines, "Organization: "+strings.Join(org, ", "))
+			}
+		}
+
+		summaries = append(summaries, strings.Join(lines, "\n"))
+	}
+
+	return strings.Join(summaries, "\n\n")
+}
+
+// contactsFileName returns the name of the vCard file of the contacts.
+func contactsFileName(cards []types.CloudContactCard) string {
+	name := "contacts"
+	if len(cards) == 1 {
+		name = vCardFileNameRegex.ReplaceAllString(cards[0].Name.FormattedName, "")
+		name = strings.TrimSpace(name)
+	}
+	if name == "" {
+		name = "contact"
+	}
+	return name + ".vcf"
+}
+
+// uploadContactsFile uploads the vCard of the contacts to Matrix and returns an m.file event
+// that uses the readable text of the contacts as its caption.
+func uploadContactsFile(
+	ctx context.Context,
+	intent bridgev2.MatrixAPI,
+	portal *bridgev2.Portal,
+	cards []types.CloudContactCard,
+) (*event.MessageEventContent, error) {
+	vCard := buildVCard(cards)
+	fileName := contactsFileName(cards)
+
+	url, file, err := intent.UploadMedia(ctx, portal.MXID, vCard, fileName, "text/vcard")
+	if err != nil {
+		return nil, fmt.Errorf("failed to upload vCard: %w", err)
+	}
+
+	return &event.MessageEventContent{
+		MsgType:  event.MsgFile,
+		Body:     formatContactsSummary(cards),
+		FileName: fileName,
+		URL:      url,
+		File:     file,
+		Info: &event.FileInfo{
+			MimeType: "text/vcard",
+			Size:     len(vCard),
+		},
+	}, nil
+}
+
+// convertContactsMessage converts the contacts of a WhatsApp Cloud message into a vCard file.
+// The readable text of the contacts is still bridged if the file can't be uploaded.
+func (mc *MessageConverter) convertContactsMessage(
+	ctx context.Context,
+	msg *types.CloudValue,
+	intent bridgev2.MatrixAPI,
+	portal *bridgev2.Portal,
+) (*bridgev2.ConvertedMessagePart, *CloudMessageInfo) {
+	cards := msg.Messages[0].Contacts
+	if len(cards) == 0 {
+		zerolog.Ctx(ctx).Warn().Msg("Contacts data is empty in the message")
+		return unbridgeablePart("a contact card"), nil
+	}
+
+	content, err := uploadContactsFile(ctx, intent, portal, cards)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to bridge contacts as a vCard file")
+		content = &event.MessageEventContent{
+			MsgType: event.MsgText,
+			Body:    formatContactsSummary(cards),
+		}
+	}
+
+	return &bridgev2.ConvertedMessagePart{
+		Type:    event.EventMessage,
+		Content: content,
+	}, nil
+}
+
+// isVCardFile checks if a Matrix file is a vCard, by its mime type or its extension.
+func isVCardFile(content *event.MessageEventContent) bool {
+	if content.MsgType != event.MsgFile {
+		return false
+	}
+
+	if content.Info != nil {
+		mimeType, _, _ := strings.Cut(strings.ToLower(content.Info.MimeType), ";")
+		for _, vCardMimeType := range vCardMimeTypes {
+			if mimeType == vCardMimeType {
+				return true
+			}
+		}
+	}
+
+	extension := strings.ToLower(path.Ext(content.GetFileName()))
+	return extension == ".vcf" || extension == ".vcard"
+}
+
+// prepareContactsMessage downloads the vCard file of a Matrix message and converts its cards
+// into the contacts of a WhatsApp Cloud message.
+func (whatsappClient *WhatsappCloudClient) prepareContactsMessage(
+	ctx context.Context, content *event.MessageEventContent,
+) ([]types.CloudContactCard, error) {
+	if content.Info != nil && content.Info.Size > maxVCardSize {
+		return nil, fmt.Errorf("the vCard is too big to be converted into contacts")
+	}
+
+	data, err := whatsappClient.Main.Bridge.Bot.DownloadMedia(ctx, content.URL, content.File)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
+	}
+
+	return parseVCard(data)
+}
+
+// SendContacts sends contacts to the WhatsApp user of the portal and returns the ID of the
+// sent message.
+func (whatsappClient *WhatsappCloudClient) SendContacts(
+	ctx context.Context, portal *bridgev2.Portal, cards []types.CloudContactCard,
+) (string, error) {
+	return whatsappClient.sendCloudMessage(ctx, string(portal.Receiver), "", "contacts", cards)
+}
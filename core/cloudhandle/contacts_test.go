@@ -0,0 +1,244 @@
+package cloudhandle
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+)
+
+func TestVCardRoundTrip(t *testing.T) {
+	tests := []struct {
+		name  string
+		cards []types.CloudContactCard
+	}{
+		{
+			name: "minimal",
+			cards: []types.CloudContactCard{{
+				Name:   types.CloudContactName{FormattedName: "John Doe"},
+				Phones: []types.CloudContactPhone{{Phone: "+1 555 0100"}},
+			}},
+		},
+		{
+			name: "full",
+			cards: []types.CloudContactCard{{
+				Name: types.CloudContactName{
+					FormattedName: "Dr. Jane Q. Public Jr.",
+					FirstName:     "Jane",
+					LastName:      "Public",
+					MiddleName:    "Q.",
+					Prefix:        "Dr.",
+					Suffix:        "Jr.",
+				},
+				Phones: []types.CloudContactPhone{
+					{Phone: "+57 300 123 4567", Type: "CELL", WaID: "573001234567"},
+					{Phone: "+57 1 234 5678", Type: "WORK"},
+				},
+				Emails: []types.CloudContactEmail{{Email: "jane@example.com", Type: "WORK"}},
+				Org: &types.CloudContactOrg{
+					Company:    "Example, Inc.",
+					Department: "R&D",
+					Title:      "Engineer",
+				},
+				Addresses: []types.CloudContactAddress{{
+					Street:  "Calle 1; Apt 2",
+					City:    "Bogotá",
+					State:   "Cundinamarca",
+					Zip:     "110111",
+					Country: "Colombia",
+					Type:    "HOME",
+				}},
+				URLs:     []types.CloudContactURL{{URL: "https://example.com/a,b;c", Type: "WORK"}},
+				Birthday: "1990-05-17",
+			}},
+		},
+		{
+			name: "escaped characters",
+			cards: []types.CloudContactCard{{
+				Name:   types.CloudContactName{FormattedName: `Back\slash, semi;colon`},
+				Phones: []types.CloudContactPhone{{Phone: "123"}},
+				Org:    &types.CloudContactOrg{Title: "Line one\nLine two"},
+			}},
+		},
+		{
+			name: "multiple cards",
+			cards: []types.CloudContactCard{
+				{
+					Name:   types.CloudContactName{FormattedName: "First"},
+					Phones: []types.CloudContactPhone{{Phone: "1"}},
+				},
+				{
+					Name:   types.CloudContactName{FormattedName: "Second"},
+					Emails: []types.CloudContactEmail{{Email: "second@example.com"}},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			parsed, err := parseVCard(buildVCard(test.cards))
+			if err != nil {
+				t.Fatalf("parseVCard() error = %v", err)
+			}
+			if !reflect.DeepEqual(parsed, test.cards) {
+				t.Errorf("parseVCard(buildVCard()) = %+v, want %+v", parsed, test.cards)
+			}
+		})
+	}
+}
+
+func TestParseVCardExports(t *testing.T) {
+	tests := []struct {
+		name  string
+		vCard string
+		want  []types.CloudContactCard
+	}{
+		{
+			name: "android",
+			vCard: strings.Join([]string{
+				"BEGIN:VCARD",
+				"VERSION:2.1",
+				"N;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:Rodr=C3=ADguez;=C3=81lvaro;;;",
+				"FN;CHARSET=UTF-8;ENCODING=QUOTED-PRINTABLE:=C3=81lvaro=20Rodr=C3=ADguez=20Fern=",
+				"=C3=A1ndez",
+				"TEL;CELL;PREF:+57 300 123 4567",
+				"TEL;HOME:601 234 5678",
+				"EMAIL;HOME:alvaro@example.com",
+				"END:VCARD",
+				"",
+			}, "\r\n"),
+			want: []types.CloudContactCard{{
+				Name: types.CloudContactName{
+					FormattedName: "Álvaro Rodríguez Fernández",
+					FirstName:     "Álvaro",
+					LastName:      "Rodríguez",
+				},
+				Phones: []types.CloudContactPhone{
+					{Phone: "+57 300 123 4567", Type: "CELL"},
+					{Phone: "601 234 5678", Type: "HOME"},
+				},
+				Emails: []types.CloudContactEmail{{Email: "alvaro@example.com", Type: "HOME"}},
+			}},
+		},
+		{
+			name: "ios",
+			vCard: strings.Join([]string{
+				"BEGIN:VCARD",
+				"VERSION:3.0",
+				"PRODID:-//Apple Inc.//iPhone OS 17.0//EN",
+				"N:Appleseed;John;;;",
+				"FN:John Appleseed",
+				"ORG:Apple Inc.;",
+				"TITLE:Designer",
+				"item1.TEL;type=CELL;type=VOICE;type=pref:+1 (555) 010-0100",
+				"item1.X-ABLabel:mobile",
+				"EMAIL;type=INTERNET;type=WORK;type=pref:john@example.com",
+				"item2.ADR;type=HOME;type=pref:;;1 Infinite Loop;Cupertino;CA;95014;United Sta",
+				" tes",
+				"item2.X-ABADR:us",
+				"item3.URL;type=pref:https://www.apple.com",
+				"BDAY;value=date:1976-04-01",
+				"PHOTO;ENCODING=b;TYPE=JPEG:/9j/4AAQSkZJRgABAQAAAQABAAD",
+				" /2wBDAAMCAgICAgMCAgIDAwMDBAYEBAQEBAgGBgUGCQgKCgkICQkKDA8MCgsOCwkJDRENDg8Q",
+				"END:VCARD",
+				"",
+			}, "\r\n"),
+			want: []types.CloudContactCard{{
+				Name: types.CloudContactName{
+					FormattedName: "John Appleseed",
+					FirstName:     "John",
+					LastName:      "Appleseed",
+				},
+				Phones: []types.CloudContactPhone{{Phone: "+1 (555) 010-0100", Type: "CELL"}},
+				Emails: []types.CloudContactEmail{{Email: "john@example.com", Type: "WORK"}},
+				Org:    &types.CloudContactOrg{Company: "Apple Inc.", Title: "Designer"},
+				Addresses: []types.CloudContactAddress{{
+					Street:  "1 Infinite Loop",
+					City:    "Cupertino",
+					State:   "CA",
+					Zip:     "95014",
+					Country: "United States",
+					Type:    "HOME",
+				}},
+				URLs:     []types.CloudContactURL{{URL: "https://www.apple.com"}},
+				Birthday: "1976-04-01",
+			}},
+		},
+		{
+			name: "whatsapp",
+			vCard: strings.Join([]string{
+				"BEGIN:VCARD",
+				"VERSION:3.0",
+				"N:;Support;;;",
+				"FN:Support",
+				"TEL;type=CELL;type=VOICE;waid=573001234567:+57 300 1234567",
+				"BDAY:19900517",
+				"END:VCARD",
+			}, "\n"),
+			want: []types.CloudContactCard{{
+				Name: types.CloudContactName{FormattedName: "Support", FirstName: "Support"},
+				Phones: []types.CloudContactPhone{
+					{Phone: "+57 300 1234567", Type: "CELL", WaID: "573001234567"},
+				},
+				Birthday: "1990-05-17",
+			}},
+		},
+		{
+			name: "name from phone",
+			vCard: strings.Join([]string{
+				"BEGIN:VCARD",
+				"VERSION:4.0",
+				"TEL;VALUE=uri:tel:+15550100",
+				"END:VCARD",
+			}, "\r\n"),
+			want: []types.CloudContactCard{{
+				Name:   types.CloudContactName{FormattedName: "+15550100"},
+				Phones: []types.CloudContactPhone{{Phone: "+15550100"}},
+			}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cards, err := parseVCard([]byte(test.vCard))
+			if err != nil {
+				t.Fatalf("parseVCard() error = %v", err)
+			}
+			if !reflect.DeepEqual(cards, test.want) {
+				t.Errorf("parseVCard() = %+v, want %+v", cards, test.want)
+			}
+		})
+	}
+}
+
+func TestParseVCardWithoutContacts(t *testing.T) {
+	vCards := []string{"", "BEGIN:VCARD\r\nVERSION:3.0\r\nEND:VCARD\r\n", "not a vcard"}
+	for _, vCard := range vCards {
+		_, err := parseVCard([]byte(vCard))
+		if err == nil {
+			t.Errorf("parseVCard(%q) error = nil, want an error", vCard)
+		}
+	}
+}
+
+func TestSplitVCardValue(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{value: "", want: []string{""}},
+		{value: "Doe;John;;;", want: []string{"Doe", "John", "", "", ""}},
+		{value: `Example\; Inc.;Sales`, want: []string{"Example; Inc.", "Sales"}},
+		{value: `a\,b\\c\nd\Ne`, want: []string{"a,b\\c\nd\ne"}},
+		{value: `trailing\`, want: []string{`trailing\`}},
+	}
+
+	for _, test := range tests {
+		got := splitVCardValue(test.value)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("splitVCardValue(%q) = %q, want %q", test.value, got, test.want)
+		}
+	}
+}
@@ -18,6 +18,7 @@ package cloudhandle
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
@@ -46,27 +47,40 @@ func (mc *MessageConverter) convertMediaMessage(
 		return nil, nil
 	}
 
-	var mxcURL string
+	media, ok := ctx.Value(contextKeyPreuploadedMedia).(*preuploadedMedia)
+	if !ok || media == nil {
+		log.Warn().Msg("No preuploaded media found in context, media will not be available")
+		return nil, nil
+	}
 
-	if preuploadedMXC := ctx.Value("preuploadedMXC"); preuploadedMXC != nil {
-		mxcURL = preuploadedMXC.(string)
-		log.Info().Str("mxc_url", mxcURL).Msg("Using preuploadedMXC from context")
-	} else {
-		log.Warn().Msg("No preuploadedMXC found in context, media will not be available")
+	log.Info().Str("mxc_url", string(media.MXC)).Msg("Using preuploaded media from context")
+
+	preparedMedia, err := prepareMediaMessage(msg)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to prepare media message")
 		return nil, nil
 	}
 
-	preparedMedia := prepareMediaMessage(msg)
 	preparedMedia.TypeDescription = typeName
-	preparedMedia.URL = id.ContentURIString(mxcURL)
+	preparedMedia.URL = media.MXC
+	preparedMedia.File = media.File
+	preparedMedia.Info.Size = media.Size
+	preparedMedia.Info.Duration = media.Duration
+	if media.MimeType != "" {
+		preparedMedia.Info.MimeType = media.MimeType
+	}
+	if preparedMedia.MSC1767Audio != nil {
+		preparedMedia.MSC1767Audio.Duration = media.Duration
+	}
 
 	if preparedMedia.FileName != "" && preparedMedia.Body != preparedMedia.FileName {
 		mc.parseFormatting(preparedMedia.MessageEventContent, false, false)
 	}
 	contextInfo = preparedMedia.ContextInfo
 	part = &bridgev2.ConvertedMessagePart{
-		Type:    event.EventMessage,
+		Type:    preparedMedia.Type,
 		Content: preparedMedia.MessageEventContent,
+		Extra:   preparedMedia.Extra,
 	}
 
 	return
@@ -107,6 +121,18 @@ func (mc *MessageConverter) convertTextMessage(
 	return
 }
 
+// unbridgeablePart returns a notice that tells the agent that a message of the given kind
+// couldn't be bridged.
+func unbridgeablePart(kind string) *bridgev2.ConvertedMessagePart {
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    fmt.Sprintf("Failed to bridge %s, please view it on the WhatsApp app", kind),
+		},
+	}
+}
+
 // convertUnknownMessage handles messages of an unknown or unsupported type.
 // It returns a generic notice message to inform the user to check the message on their device.
 func (mc *MessageConverter) convertUnknownMessage(
@@ -0,0 +1,72 @@
+package cloudhandle
+
+import (
+	"context"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	dedupeKindMessage  = "message"
+	dedupeKindReaction = "reaction"
+	// dedupeKindStatus is followed by the status, because a message gets a status for every step.
+	dedupeKindStatus = "status_"
+
+	defaultDedupeRetention = 7 * 24 * time.Hour
+	dedupePruneInterval    = time.Hour
+)
+
+// claimCloudID marks an ID received from WhatsApp Cloud as processed for the WABA of the client.
+// It returns false if the ID was already processed, because Meta sends the webhooks again when
+// they aren't acknowledged quickly.
+func (whatsappClient *WhatsappCloudClient) claimCloudID(
+	ctx context.Context, messageID string, kind string,
+) (bool, error) {
+	return whatsappClient.Main.DB.ProcessedMessage.Claim(
+		ctx, string(whatsappClient.UserLogin.ID), messageID, kind,
+	)
+}
+
+// releaseCloudID removes a claimed ID after it failed to be processed, so it can be retried.
+func (whatsappClient *WhatsappCloudClient) releaseCloudID(
+	ctx context.Context, messageID string, kind string,
+) {
+	err := whatsappClient.Main.DB.ProcessedMessage.Release(
+		ctx, string(whatsappClient.UserLogin.ID), messageID, kind,
+	)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Str("message_id", messageID).
+			Msg("Failed to release processed message ID")
+	}
+}
+
+// dedupeRetention returns how long the processed IDs are kept.
+func (whatsappConnector *WhatsappCloudConnector) dedupeRetention() time.Duration {
+	retention := whatsappConnector.Config.WhatsApp.CloudDedupeRetention
+	if retention == nil || *retention <= 0 {
+		return defaultDedupeRetention
+	}
+	return time.Duration(*retention) * time.Hour
+}
+
+// pruneProcessedMessages periodically deletes the processed IDs older than the retention window.
+func (whatsappConnector *WhatsappCloudConnector) pruneProcessedMessages(ctx context.Context) {
+	log := zerolog.Ctx(ctx).With().Str("action", "prune processed messages").Logger()
+	ticker := time.NewTicker(dedupePruneInterval)
+	defer ticker.Stop()
+
+	for {
+		before := time.Now().Add(-whatsappConnector.dedupeRetention())
+		err := whatsappConnector.DB.ProcessedMessage.DeleteOlderThan(ctx, before)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to delete old processed message IDs")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
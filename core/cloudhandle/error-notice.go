@@ -0,0 +1,108 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+)
+
+const defaultLanguage = "en"
+
+// getLanguage returns the language used for the notices of a portal. The language of the portal
+// has priority, then the language of the app and finally the default one from the config.
+func (whatsappClient *WhatsappCloudClient) getLanguage(
+	ctx context.Context, portal *bridgev2.Portal,
+) string {
+	if portal != nil {
+		if metadata, ok := portal.Metadata.(*waid.PortalMetadata); ok && metadata.Language != "" {
+			return metadata.Language
+		}
+	}
+
+	app, err := whatsappClient.getApp(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to get the app to choose the language")
+	} else if app != nil && app.Language != "" {
+		return app.Language
+	}
+
+	configLanguage := whatsappClient.Main.Config.WhatsApp.CloudLanguage
+	if configLanguage != nil && *configLanguage != "" {
+		return *configLanguage
+	}
+
+	return defaultLanguage
+}
+
+// sendErrorNotice posts the reason of a WhatsApp Cloud error code into the portal. The reason
+// is taken from the error_codes config, and unknown codes fall back to the title and message
+// sent by Meta.
+func (whatsappClient *WhatsappCloudClient) sendErrorNotice(
+	ctx context.Context, portal *bridgev2.Portal, code int, title string, message string,
+) {
+	body := fmt.Sprintf("%s: %s", title, message)
+
+	if errorCodes := whatsappClient.Main.Config.WhatsApp.CloudErrorCodes; errorCodes != nil {
+		if errorCode, ok := (*errorCodes)[code]; ok {
+			if reason := errorCode.Reason(whatsappClient.getLanguage(ctx, portal)); reason != nil {
+				body = *reason
+			}
+		}
+	}
+
+	whatsappClient.sendPortalNotice(ctx, portal, fmt.Sprintf("%s (%d)", body, code))
+}
+
+// sendPortalNotice sends an m.notice with the given text into the portal using the bridge bot.
+func (whatsappClient *WhatsappCloudClient) sendPortalNotice(
+	ctx context.Context, portal *bridgev2.Portal, body string,
+) {
+	log := zerolog.Ctx(ctx)
+
+	if portal == nil || portal.MXID == "" {
+		log.Warn().Str("notice", body).Msg("Can't send notice because the portal has no room")
+		return
+	}
+
+	content := &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    body,
+		},
+	}
+
+	intent := whatsappClient.Main.Bridge.Bot
+	_, err := intent.SendMessage(ctx, portal.MXID, event.EventMessage, content, nil)
+	if err != nil {
+		log.Error().Err(err).Str("notice", body).Msg("Failed to send notice to portal")
+	}
+}
+
+// sendManagementNotice sends an m.notice with the given text into the management room of the
+// user of the login using the bridge bot.
+func (whatsappClient *WhatsappCloudClient) sendManagementNotice(ctx context.Context, body string) {
+	log := zerolog.Ctx(ctx)
+
+	user := whatsappClient.UserLogin.User
+	if user == nil || user.ManagementRoom == "" {
+		log.Warn().Str("notice", body).Msg("Can't send notice because the user has no management room")
+		return
+	}
+
+	content := &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    body,
+		},
+	}
+
+	intent := whatsappClient.Main.Bridge.Bot
+	_, err := intent.SendMessage(ctx, user.ManagementRoom, event.EventMessage, content, nil)
+	if err != nil {
+		log.Error().Err(err).Str("notice", body).Msg("Failed to send notice to management room")
+	}
+}
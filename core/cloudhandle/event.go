@@ -5,11 +5,18 @@ import (
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
 	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/go/id"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
 	"github.com/rs/zerolog"
 )
 
+var (
+	_ bridgev2.RemoteReaction       = (*WAMessageEvent)(nil)
+	_ bridgev2.RemoteReactionRemove = (*WAMessageEvent)(nil)
+)
+
 type MessageInfoWrapper struct {
 	Info           CloudMessageInfo
 	whatsappClient *WhatsappCloudClient
@@ -17,13 +24,24 @@ type MessageInfoWrapper struct {
 
 type WAMessageEvent struct {
 	*MessageInfoWrapper
-	Message  types.CloudValue
-	MsgEvent types.CloudEvent
+	Message types.CloudValue
 
 	parsedMessageType             string
 	isUndecryptableUpsertSubEvent bool
 	postHandle                    func()
-	preuploadedMXC                string
+	preuploadedMedia              *preuploadedMedia
+	targetMessage                 networkid.MessageID
+}
+
+// preuploadedMedia is the media of a message that was already uploaded to the homeserver
+// before the event was queued.
+type preuploadedMedia struct {
+	MXC      id.ContentURIString
+	File     *event.EncryptedFileInfo
+	MimeType string
+	Size     int
+	// Duration is the duration of audios and videos in milliseconds, if it could be probed.
+	Duration int
 }
 
 func (evt *MessageInfoWrapper) AddLogContext(c zerolog.Context) zerolog.Context {
@@ -44,8 +62,8 @@ func (evt *MessageInfoWrapper) GetSender() bridgev2.EventSender {
 }
 
 func (evt *WAMessageEvent) ConvertMessage(ctx context.Context, portal *bridgev2.Portal, intent bridgev2.MatrixAPI) (*bridgev2.ConvertedMessage, error) {
-	if evt.preuploadedMXC != "" {
-		ctx = context.WithValue(ctx, "preuploadedMXC", evt.preuploadedMXC)
+	if evt.preuploadedMedia != nil {
+		ctx = context.WithValue(ctx, contextKeyPreuploadedMedia, evt.preuploadedMedia)
 	}
 
 	converted := evt.whatsappClient.Main.MsgConv.ToMatrix(
@@ -79,3 +97,27 @@ func (evt *WAMessageEvent) GetType() bridgev2.RemoteEventType {
 func (evt *MessageInfoWrapper) GetID() networkid.MessageID {
 	return waid.MakeMessageID(evt.Info.Chat, evt.Info.Chat, evt.Info.ID)
 }
+
+// GetTargetMessage returns the message that a reaction is targeting.
+func (evt *WAMessageEvent) GetTargetMessage() networkid.MessageID {
+	return evt.targetMessage
+}
+
+// getReaction returns the reaction of the event, or an empty one if it has none.
+func (evt *WAMessageEvent) getReaction() *types.CloudReaction {
+	if len(evt.Message.Messages) == 0 || evt.Message.Messages[0].Reaction == nil {
+		return &types.CloudReaction{}
+	}
+	return evt.Message.Messages[0].Reaction
+}
+
+// GetReactionEmoji returns the emoji of a reaction. WhatsApp only allows one reaction per user
+// on each message, so the emoji ID is empty to replace the previous reaction.
+func (evt *WAMessageEvent) GetReactionEmoji() (string, networkid.EmojiID) {
+	return evt.getReaction().Emoji, ""
+}
+
+// GetRemovedEmojiID returns the emoji ID of a removed reaction, which is always empty.
+func (evt *WAMessageEvent) GetRemovedEmojiID() networkid.EmojiID {
+	return ""
+}
@@ -47,13 +47,46 @@ func (mc *MessageConverter) ToWhatsApp(
 
 	message := &bridgev2.MatrixMessage{}
 
+	// Templates and interactive messages can be sent with any message type, the body is only
+	// shown in the room.
+	templateMessage, err := getTemplateMessage(evt)
+	if err != nil {
+		return nil, err
+	}
+	interactiveMessage, err := getInteractiveMessage(evt)
+	if err != nil {
+		return nil, err
+	}
+	if templateMessage != nil || interactiveMessage != nil {
+		return &bridgev2.MatrixMessage{
+			MatrixEventBase: bridgev2.MatrixEventBase[*event.MessageEventContent]{
+				Event:   evt,
+				Portal:  portal,
+				Content: content,
+			},
+			ReplyTo: replyTo,
+		}, nil
+	}
+
 	switch content.MsgType {
 	case event.MsgText:
 		message = mc.constructTextMessage(ctx, content, evt, portal)
+	case event.MsgLocation:
+		message = &bridgev2.MatrixMessage{
+			MatrixEventBase: bridgev2.MatrixEventBase[*event.MessageEventContent]{
+				Event:   evt,
+				Portal:  portal,
+				Content: content,
+			},
+		}
+	case event.MsgImage, event.MsgVideo, event.MsgAudio, event.MsgFile,
+		event.MessageType(event.EventSticker.Type):
+		message = mc.constructMediaMessage(ctx, content, evt, portal)
 	default:
 		return nil, fmt.Errorf("%w %s", bridgev2.ErrUnsupportedMessageType, content.MsgType)
 	}
 
+	message.ReplyTo = replyTo
 	return message, nil
 }
 
@@ -100,6 +133,27 @@ func (mc *MessageConverter) constructTextMessage(
 	return matrix_message
 }
 
+// constructMediaMessage builds a media message object from the given content.
+// The caption is converted to the WhatsApp formatting, the media itself is uploaded when sending.
+func (mc *MessageConverter) constructMediaMessage(
+	ctx context.Context,
+	content *event.MessageEventContent,
+	evt *event.Event,
+	portal *bridgev2.Portal,
+) *bridgev2.MatrixMessage {
+	if content.GetCaption() != "" {
+		content.Body, _ = mc.parseText(ctx, content)
+	}
+
+	return &bridgev2.MatrixMessage{
+		MatrixEventBase: bridgev2.MatrixEventBase[*event.MessageEventContent]{
+			Event:   evt,
+			Portal:  portal,
+			Content: content,
+		},
+	}
+}
+
 // convertPill handles the conversion of a Matrix user mention (a "pill")
 // into a format that WhatsApp can understand, typically an @-mention with a JID.
 func (mc *MessageConverter) convertPill(
@@ -24,6 +24,7 @@ import (
 	_ "image/png"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
 	"github.com/iKonoTelecomunicaciones/go/event"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
@@ -37,6 +38,14 @@ const (
 	contextKeyClient contextKey = iota
 	contextKeyIntent
 	contextKeyPortal
+	contextKeyPreuploadedMedia
+	contextKeyLastAttempt
+)
+
+// The content keys used to mark the messages that were forwarded in WhatsApp.
+const (
+	forwardedContentKey           = "com.ikono.whatsapp.forwarded"
+	frequentlyForwardedContentKey = "com.ikono.whatsapp.frequently_forwarded"
 )
 
 func getPortal(ctx context.Context) *bridgev2.Portal {
@@ -51,6 +60,14 @@ var failedCommentPart = &bridgev2.ConvertedMessagePart{
 	},
 }
 
+var failedMediaPart = &bridgev2.ConvertedMessagePart{
+	Type: event.EventMessage,
+	Content: &event.MessageEventContent{
+		Body:    "Failed to bridge media, please view it on the WhatsApp app",
+		MsgType: event.MsgNotice,
+	},
+}
+
 // ToMatrix converts an incoming WhatsApp Cloud message into a `ConvertedMessage`
 // that can be processed by the bridge and sent to Matrix. It determines the
 // message type and calls the appropriate conversion helper function.
@@ -72,20 +89,31 @@ func (mc *MessageConverter) ToMatrix(
 	ctx = context.WithValue(ctx, contextKeyPortal, portal)
 
 	var part *bridgev2.ConvertedMessagePart
-	var status_part *bridgev2.ConvertedMessagePart
 	var contextInfo *CloudMessageInfo
 
 	switch message.Type {
 	case "text":
 		part, contextInfo = mc.convertTextMessage(ctx, waMsg)
-	case "image":
+	case "image", "video", "audio", "document", "sticker":
 		part, contextInfo = mc.convertMediaMessage(
-			ctx, waMsg, "image", client, intent, &portal.MXID,
+			ctx, waMsg, message.Type, client, intent, &portal.MXID,
 		)
+	case "location":
+		part, contextInfo = mc.convertLocationMessage(ctx, waMsg, intent, portal)
+	case "contacts":
+		part, contextInfo = mc.convertContactsMessage(ctx, waMsg, intent, portal)
+	case "interactive", "button":
+		part, contextInfo = mc.convertInteractiveMessage(ctx, waMsg)
 	default:
 		part, contextInfo = mc.convertUnknownMessage(ctx, waMsg)
 	}
 
+	if part == nil {
+		// The failed part is copied, so the shared one isn't changed below.
+		failedContent := *failedMediaPart.Content
+		part = &bridgev2.ConvertedMessagePart{Type: failedMediaPart.Type, Content: &failedContent}
+	}
+
 	part.Content.Mentions = &event.Mentions{}
 	if part.DBMetadata == nil {
 		part.DBMetadata = &waid.MessageMetadata{}
@@ -100,16 +128,58 @@ func (mc *MessageConverter) ToMatrix(
 	dbMeta := part.DBMetadata.(*waid.MessageMetadata)
 	dbMeta.SenderDeviceID = senderDeviceID
 
-	parts_to_send := []*bridgev2.ConvertedMessagePart{part}
-	if status_part != nil {
-		parts_to_send = append([]*bridgev2.ConvertedMessagePart{status_part}, parts_to_send...)
+	// Messages from ads and posts are shown after a notice with their referral. The notice is a
+	// separate event, so replies and statuses of the message don't target it.
+	if message.Referral != nil {
+		client.sendReferralNotice(ctx, portal, message.Referral)
 	}
 
 	cm := &bridgev2.ConvertedMessage{
-		Parts: parts_to_send,
+		Parts: []*bridgev2.ConvertedMessagePart{part},
+	}
+
+	if message.Context != nil {
+		mc.convertMessageContext(ctx, portal, client, message.Context, cm, part)
 	}
 
 	log.Debug().Msgf("Getting contextInfo: %v", contextInfo)
 
 	return cm
 }
+
+// convertMessageContext adds the reply and the forwarded marker of a WhatsApp message to the
+// converted message. Replies to messages that weren't bridged are sent as normal messages.
+func (mc *MessageConverter) convertMessageContext(
+	ctx context.Context,
+	portal *bridgev2.Portal,
+	client *WhatsappCloudClient,
+	messageContext *types.CloudMessageContext,
+	cm *bridgev2.ConvertedMessage,
+	part *bridgev2.ConvertedMessagePart,
+) {
+	log := zerolog.Ctx(ctx)
+
+	if messageContext.ID != "" {
+		target, err := client.findMessage(ctx, portal, messageContext.ID)
+		if err != nil {
+			log.Error().Err(err).Str("reply_to", messageContext.ID).Msg("Failed to get reply target")
+		} else if target == nil {
+			log.Debug().Str("reply_to", messageContext.ID).Msg("Reply target wasn't bridged")
+		} else {
+			cm.ReplyTo = &networkid.MessageOptionalPartID{
+				MessageID: target.ID,
+				PartID:    &target.PartID,
+			}
+		}
+	}
+
+	if messageContext.Forwarded || messageContext.FrequentlyForwarded {
+		if part.Extra == nil {
+			part.Extra = map[string]any{}
+		}
+		part.Extra[forwardedContentKey] = true
+		if messageContext.FrequentlyForwarded {
+			part.Extra[frequentlyForwardedContentKey] = true
+		}
+	}
+}
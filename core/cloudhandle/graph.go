@@ -0,0 +1,121 @@
+package cloudhandle
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+)
+
+// maxGraphErrorBodySize is the maximum size of an error body that will be read from the Graph API.
+const maxGraphErrorBodySize = 64 * 1024
+
+// GraphURL builds the URL of a Graph API endpoint using the configured base URL and version.
+func (whatsappConnector *WhatsappCloudConnector) GraphURL(path ...string) string {
+	return fmt.Sprintf(
+		"%s/%s/%s",
+		*whatsappConnector.Config.WhatsApp.CloudURL,
+		*whatsappConnector.Config.WhatsApp.CloudVersion,
+		strings.Join(path, "/"),
+	)
+}
+
+// doGraphRequest sends a request to the Graph API with the given access token and decodes the
+// JSON response into the response value, if it's not nil.
+// Error responses are returned as a *types.GraphError, so callers can inspect the error code.
+func doGraphRequest(
+	ctx context.Context,
+	accessToken string,
+	method string,
+	url string,
+	contentType string,
+	body io.Reader,
+	response any,
+) error {
+	req, err := http.NewRequestWithContext(ctx, method, url, body)
+	if err != nil {
+		return fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return parseGraphError(resp)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(response)
+	if err != nil {
+		return fmt.Errorf("failed to decode response: %w, status: %d", err, resp.StatusCode)
+	}
+
+	return nil
+}
+
+// parseGraphError reads the error object of a failed Graph API response. If the body doesn't
+// contain an error object, a generic error with the status code is returned.
+func parseGraphError(resp *http.Response) error {
+	var errorResponse types.GraphErrorResponse
+	err := json.NewDecoder(io.LimitReader(resp.Body, maxGraphErrorBodySize)).Decode(&errorResponse)
+
+	if err != nil || errorResponse.Error == nil {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	errorResponse.Error.StatusCode = resp.StatusCode
+	return errorResponse.Error
+}
+
+// graphRequest sends a request to the Graph API using the access token of the login. The login
+// is put in the bad credentials state if the access token is rejected.
+func (whatsappClient *WhatsappCloudClient) graphRequest(
+	ctx context.Context,
+	method string,
+	url string,
+	contentType string,
+	body io.Reader,
+	response any,
+) error {
+	// Sends are paused while the access token is rejected, but GET requests still check it.
+	if method != http.MethodGet && whatsappClient.badCredentials.Load() {
+		return errBadCredentials
+	}
+
+	metadata := whatsappClient.GetMetaData(ctx)
+	err := doGraphRequest(ctx, metadata.PageAccessToken, method, url, contentType, body, response)
+	if isCredentialsError(err) {
+		whatsappClient.handleCredentialsError(ctx, err)
+	}
+	return err
+}
+
+// graphJSONRequest sends a JSON body to the Graph API using the access token of the login.
+func (whatsappClient *WhatsappCloudClient) graphJSONRequest(
+	ctx context.Context, method string, url string, data any, response any,
+) error {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request data to JSON: %w", err)
+	}
+
+	return whatsappClient.graphRequest(
+		ctx, method, url, "application/json", bytes.NewReader(jsonData), response,
+	)
+}
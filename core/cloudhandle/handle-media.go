@@ -1,12 +1,15 @@
 package cloudhandle
 
 import (
+	"context"
 	"fmt"
 	"time"
 
 	"github.com/iKonoTelecomunicaciones/go/event"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
 	"go.mau.fi/util/exmime"
+	"go.mau.fi/util/ffmpeg"
 )
 
 type FailedMediaKeys struct {
@@ -29,10 +32,17 @@ type PreparedMedia struct {
 	ContextInfo                *CloudMessageInfo `json:"context_info,omitempty"`
 }
 
-func prepareMediaMessage(rawMsg *types.CloudValue) *PreparedMedia {
+// prepareMediaMessage builds the Matrix content of a WhatsApp media message, the URL and the file
+// info are filled in later from the uploaded media.
+func prepareMediaMessage(rawMsg *types.CloudValue) (*PreparedMedia, error) {
 	messageData := rawMsg.Messages[0]
 	contact := rawMsg.Contacts[0]
 
+	media := messageData.GetMedia()
+	if media == nil {
+		return nil, fmt.Errorf("media message of type %s doesn't contain media", messageData.Type)
+	}
+
 	extraInfo := map[string]any{}
 	data := &PreparedMedia{
 		Type: event.EventMessage,
@@ -44,16 +54,46 @@ func prepareMediaMessage(rawMsg *types.CloudValue) *PreparedMedia {
 		},
 	}
 
+	data.FileName = messageData.Type + exmime.ExtensionFromMimetype(media.MimeType)
+
 	switch messageData.Type {
 	case "image":
 		data.MsgType = event.MsgImage
-		data.FileName = "image" + exmime.ExtensionFromMimetype(messageData.Image.MimeType)
-		data.Body = ""
-		if messageData.Image.Caption != nil {
-			data.Body = *messageData.Image.Caption
+	case "video":
+		data.MsgType = event.MsgVideo
+		if media.Animated {
+			extraInfo["fi.mau.gif"] = true
+			extraInfo["fi.mau.loop"] = true
+			extraInfo["fi.mau.autoplay"] = true
+			extraInfo["fi.mau.hide_controls"] = true
+			extraInfo["fi.mau.no_audio"] = true
+		}
+	case "audio":
+		data.MsgType = event.MsgAudio
+		if media.Voice {
+			data.MSC3245Voice = &event.MSC3245Voice{}
+			data.MSC1767Audio = &event.MSC1767Audio{}
+			data.FileName = "Voice message" + exmime.ExtensionFromMimetype(media.MimeType)
+		}
+	case "document":
+		data.MsgType = event.MsgFile
+		if media.Filename != "" {
+			data.FileName = media.Filename
+		}
+	case "sticker":
+		data.Type = event.EventSticker
+		if media.Animated {
+			extraInfo["fi.mau.autoplay"] = true
+			extraInfo["fi.mau.loop"] = true
 		}
 	default:
-		panic(fmt.Errorf("unknown media message type %T", rawMsg))
+		return nil, fmt.Errorf("unknown media message type %s", messageData.Type)
+	}
+
+	data.Info.MimeType = media.MimeType
+	data.Body = data.FileName
+	if media.Caption != nil && *media.Caption != "" {
+		data.Body = *media.Caption
 	}
 
 	data.ContextInfo = &CloudMessageInfo{
@@ -64,5 +104,26 @@ func prepareMediaMessage(rawMsg *types.CloudValue) *PreparedMedia {
 		PushName:  string(contact.Profile.Name),
 	}
 
-	return data
+	return data, nil
+}
+
+// probeFileDuration returns the duration in milliseconds of the media in the given file.
+func probeFileDuration(ctx context.Context, path string) int {
+	probe, err := ffmpeg.Probe(ctx, path)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to probe media duration")
+		return 0
+	}
+
+	if probe.Format != nil && probe.Format.Duration > 0 {
+		return int(probe.Format.Duration * 1000)
+	}
+
+	for _, stream := range probe.Streams {
+		if stream.Duration > 0 {
+			return int(stream.Duration * 1000)
+		}
+	}
+
+	return 0
 }
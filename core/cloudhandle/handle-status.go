@@ -0,0 +1,182 @@
+package cloudhandle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/database"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/simplevent"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/status"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/go/id"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+)
+
+// HandleCloudStatuses bridges the delivery statuses of the messages sent to WhatsApp
+// back to the Matrix events they were sent from. The statuses that failed are returned, so only
+// they are retried.
+func (whatsappClient *WhatsappCloudClient) HandleCloudStatuses(
+	ctx context.Context, statuses types.CloudStatuses,
+) (types.CloudStatuses, error) {
+	var failedStatuses types.CloudStatuses
+	var statusErrors []error
+
+	for _, messageStatus := range statuses {
+		err := whatsappClient.handleCloudStatus(ctx, messageStatus)
+		if err != nil {
+			failedStatuses = append(failedStatuses, messageStatus)
+			statusErrors = append(statusErrors, err)
+		}
+	}
+
+	return failedStatuses, errors.Join(statusErrors...)
+}
+
+// handleCloudStatus maps a single status to a read receipt or a message status event.
+func (whatsappClient *WhatsappCloudClient) handleCloudStatus(
+	ctx context.Context, messageStatus types.CloudStatus,
+) error {
+	log := zerolog.Ctx(ctx).With().
+		Str("message_id", messageStatus.ID).
+		Str("status", messageStatus.Status).
+		Logger()
+
+	portalKey := waid.MakePortalKey(messageStatus.RecipientID)
+	portal, err := whatsappClient.Main.Bridge.GetExistingPortalByKey(ctx, portalKey)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get portal for status")
+		return fmt.Errorf("failed to get portal for status of %s: %w", messageStatus.ID, err)
+	}
+
+	if portal == nil || portal.MXID == "" {
+		log.Debug().Msg("Ignoring status because the portal doesn't exist")
+		return nil
+	}
+
+	messageID := waid.MakeMessageID(
+		string(portal.ID), string(whatsappClient.UserLogin.ID), messageStatus.ID,
+	)
+	parts, err := whatsappClient.Main.Bridge.DB.Message.GetAllPartsByID(
+		ctx, portal.Receiver, messageID,
+	)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get target message for status")
+		return fmt.Errorf("failed to get message for status of %s: %w", messageStatus.ID, err)
+	}
+
+	if len(parts) == 0 {
+		log.Debug().Msg("Ignoring status because the message wasn't sent from Matrix")
+		return nil
+	}
+
+	// The status is only claimed once its message is found, so a status received before the
+	// message was saved isn't ignored when it's sent again.
+	dedupeKind := dedupeKindStatus + messageStatus.Status
+	isNew, err := whatsappClient.claimCloudID(ctx, messageStatus.ID, dedupeKind)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to check if the status was already processed")
+		return fmt.Errorf("failed to check if status of %s was processed: %w", messageStatus.ID, err)
+	}
+
+	if !isNew {
+		log.Debug().Msg("Ignoring status that was already processed")
+		return nil
+	}
+
+	customerID := waid.MakeUserID(messageStatus.RecipientID)
+	timestamp := parseCloudTimestamp(messageStatus.Timestamp)
+
+	switch messageStatus.Status {
+	case "read":
+		whatsappClient.UserLogin.QueueRemoteEvent(&simplevent.Receipt{
+			EventMeta: simplevent.EventMeta{
+				Type:      bridgev2.RemoteEventReadReceipt,
+				PortalKey: portalKey,
+				Sender:    bridgev2.EventSender{Sender: customerID},
+				Timestamp: timestamp,
+			},
+			LastTarget: messageID,
+			Targets:    []networkid.MessageID{messageID},
+			ReadUpTo:   timestamp,
+		})
+	case "delivered":
+		whatsappClient.sendMessageStatus(ctx, portal, parts, &bridgev2.MessageStatus{
+			Status:      event.MessageStatusSuccess,
+			DeliveredTo: []id.UserID{whatsappClient.Main.Bridge.Matrix.GhostIntent(customerID).GetMXID()},
+			IsCertain:   true,
+		})
+	case "sent":
+		whatsappClient.sendMessageStatus(ctx, portal, parts, &bridgev2.MessageStatus{
+			Status:    event.MessageStatusSuccess,
+			IsCertain: true,
+		})
+	case "failed":
+		cloudError := types.CloudError{Title: "Unknown error"}
+		if len(messageStatus.Errors) > 0 {
+			cloudError = messageStatus.Errors[0]
+		}
+
+		log.Warn().Int("error_code", cloudError.Code).Str("error_title", cloudError.Title).
+			Msg("WhatsApp Cloud failed to deliver the message")
+
+		whatsappClient.sendMessageStatus(ctx, portal, parts, &bridgev2.MessageStatus{
+			Status:      event.MessageStatusFail,
+			ErrorReason: event.MessageStatusNetworkError,
+			Message:     fmt.Sprintf("%s (code %d)", cloudError.Title, cloudError.Code),
+			InternalError: fmt.Errorf(
+				"whatsapp cloud error %d: %s: %s",
+				cloudError.Code, cloudError.Title, cloudError.ErrorData.Details,
+			),
+			IsCertain: true,
+		})
+
+		whatsappClient.sendErrorNotice(
+			ctx, portal, cloudError.Code, cloudError.Title, cloudError.Message,
+		)
+	default:
+		log.Warn().Msg("Ignoring unknown message status")
+	}
+
+	return nil
+}
+
+// sendMessageStatus sends the given status for every part of a bridged message.
+func (whatsappClient *WhatsappCloudClient) sendMessageStatus(
+	ctx context.Context,
+	portal *bridgev2.Portal,
+	parts []*database.Message,
+	messageStatus *bridgev2.MessageStatus,
+) {
+	messageStatus.Step = status.MsgStepRemote
+
+	for _, part := range parts {
+		whatsappClient.Main.Bridge.Matrix.SendMessageStatus(ctx, messageStatus, &bridgev2.MessageStatusEventInfo{
+			RoomID:        portal.MXID,
+			SourceEventID: part.MXID,
+			Sender:        part.SenderMXID,
+
+			IsSourceEventDoublePuppeted: part.IsDoublePuppeted,
+		})
+	}
+}
+
+// parseCloudTimestamp parses the unix timestamps sent by WhatsApp Cloud,
+// falling back to the current time if the timestamp is invalid.
+func parseCloudTimestamp(timestamp string) time.Time {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || seconds <= 0 {
+		return time.Now()
+	}
+
+	return time.Unix(seconds, 0)
+}
@@ -303,11 +303,16 @@ func (whatsappConnector *WhatsappCloudConnector) GetPortal(
 	return portal, nil
 }
 
-// GetWhatsappCloudClient creates and returns a new WhatsappCloudClient instance for a given user login.
+// GetWhatsappCloudClient returns the WhatsappCloudClient of a given user login, creating a new
+// one if the login doesn't have a loaded client.
 func (whatsappConnector *WhatsappCloudConnector) GetWhatsappCloudClient(
 	ctx context.Context,
 	userLogin *bridgev2.UserLogin,
 ) *WhatsappCloudClient {
+	// The loaded client is reused, so its state is shared with the bridge.
+	if wClient, ok := userLogin.Client.(*WhatsappCloudClient); ok {
+		return wClient
+	}
 
 	wClient := &WhatsappCloudClient{
 		Main:      whatsappConnector,
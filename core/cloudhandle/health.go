@@ -0,0 +1,224 @@
+package cloudhandle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/status"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+// phoneNumberFields are the fields of the phone number requested in the health checks.
+const phoneNumberFields = "display_phone_number,verified_name,quality_rating,messaging_limit_tier"
+
+// invalidTokenErrorCode is the Graph API error returned when the access token is invalid, expired
+// or revoked.
+const invalidTokenErrorCode = 190
+
+const (
+	WACloudInvalidToken status.BridgeStateErrorCode = "wa-cloud-invalid-token"
+	WACloudUnreachable  status.BridgeStateErrorCode = "wa-cloud-unreachable"
+)
+
+func init() {
+	status.BridgeStateHumanErrors.Update(status.BridgeStateErrorMap{
+		WACloudInvalidToken: "The access token of the WhatsApp Cloud app was rejected",
+		WACloudUnreachable:  "The WhatsApp Cloud API couldn't be reached",
+	})
+}
+
+// errBadCredentials is returned instead of sending requests to WhatsApp while the access token of
+// the login is known to be rejected.
+var errBadCredentials = errors.New(
+	"the access token of the app was rejected, it must be replaced before sending messages",
+)
+
+// isCredentialsError checks if a Graph API error was caused by the access token of the login.
+func isCredentialsError(err error) bool {
+	var graphError *types.GraphError
+	if !errors.As(err, &graphError) {
+		return false
+	}
+	return graphError.Code == invalidTokenErrorCode ||
+		graphError.StatusCode == http.StatusUnauthorized
+}
+
+// healthCheckInterval returns how often the health of the login is checked. No periodic checks
+// are done if it's zero.
+func (whatsappClient *WhatsappCloudClient) healthCheckInterval() time.Duration {
+	interval := whatsappClient.Main.Config.WhatsApp.CloudHealthCheckInterval
+	if interval == nil || *interval < 0 {
+		return 0
+	}
+	return time.Duration(*interval) * time.Second
+}
+
+// phoneNumberURL returns the Graph API URL of the business phone number of the login.
+func (whatsappClient *WhatsappCloudClient) phoneNumberURL(ctx context.Context) string {
+	query := url.Values{}
+	query.Set("fields", phoneNumberFields)
+	return whatsappClient.Main.GraphURL(whatsappClient.GetMetaData(ctx).BusinessPhoneID) +
+		"?" + query.Encode()
+}
+
+// GetPhoneNumber gets the business phone number of the login from the Graph API.
+func (whatsappClient *WhatsappCloudClient) GetPhoneNumber(
+	ctx context.Context,
+) (*types.CloudPhoneNumber, error) {
+	var phoneNumber types.CloudPhoneNumber
+	err := whatsappClient.graphRequest(
+		ctx, http.MethodGet, whatsappClient.phoneNumberURL(ctx), "", nil, &phoneNumber,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the phone number: %w", err)
+	}
+
+	return &phoneNumber, nil
+}
+
+// ValidateAccessToken checks that the given access token can be used to access the business phone
+// number of the login, without changing the access token of the login.
+func (whatsappClient *WhatsappCloudClient) ValidateAccessToken(
+	ctx context.Context, accessToken string,
+) (*types.CloudPhoneNumber, error) {
+	var phoneNumber types.CloudPhoneNumber
+	err := doGraphRequest(
+		ctx, accessToken, http.MethodGet, whatsappClient.phoneNumberURL(ctx), "", nil, &phoneNumber,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the phone number with the access token: %w", err)
+	}
+
+	return &phoneNumber, nil
+}
+
+// ReplaceAccessToken saves a new access token in the metadata of the login and checks its health
+// again, so sends are resumed if they were paused by a rejected token.
+func (whatsappClient *WhatsappCloudClient) ReplaceAccessToken(
+	ctx context.Context, accessToken string,
+) error {
+	whatsappClient.GetMetaData(ctx).PageAccessToken = accessToken
+	err := whatsappClient.UserLogin.Save(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to save the access token of the login: %w", err)
+	}
+
+	whatsappClient.Connect(ctx)
+	return nil
+}
+
+// runHealthCheck checks the health of the login until the context is canceled.
+func (whatsappClient *WhatsappCloudClient) runHealthCheck(ctx context.Context) {
+	whatsappClient.checkHealth(ctx)
+
+	interval := whatsappClient.healthCheckInterval()
+	if interval == 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			whatsappClient.checkHealth(ctx)
+		}
+	}
+}
+
+// checkHealth gets the phone number of the login to know if its access token still works, and
+// sends the result as the bridge state of the login.
+func (whatsappClient *WhatsappCloudClient) checkHealth(ctx context.Context) {
+	log := zerolog.Ctx(ctx)
+
+	phoneNumber, err := whatsappClient.GetPhoneNumber(ctx)
+	if ctx.Err() != nil {
+		return
+	} else if isCredentialsError(err) {
+		// The bridge state of token errors is sent by the request itself.
+		log.Warn().Err(err).Msg("Health check failed because the access token was rejected")
+		return
+	} else if err != nil {
+		log.Warn().Err(err).Msg("Health check failed")
+		whatsappClient.UserLogin.BridgeState.Send(status.BridgeState{
+			StateEvent: status.StateTransientDisconnect,
+			Error:      WACloudUnreachable,
+			Message:    err.Error(),
+		})
+		return
+	}
+
+	if whatsappClient.badCredentials.CompareAndSwap(true, false) {
+		log.Info().Msg("The access token was accepted again")
+		whatsappClient.sendManagementNotice(ctx, fmt.Sprintf(
+			"The access token of the app %s works again, messages are being sent to WhatsApp.",
+			whatsappClient.UserLogin.ID,
+		))
+	}
+	whatsappClient.updateRemoteProfile(ctx, phoneNumber)
+
+	whatsappClient.UserLogin.BridgeState.Send(status.BridgeState{
+		StateEvent: status.StateConnected,
+		Info: map[string]interface{}{
+			"quality_rating":       phoneNumber.QualityRating,
+			"messaging_limit_tier": phoneNumber.MessagingLimitTier,
+		},
+	})
+}
+
+// handleCredentialsError puts the login in the bad credentials state after the Graph API rejected
+// its access token. The owner of the app is told in the management room the first time.
+func (whatsappClient *WhatsappCloudClient) handleCredentialsError(ctx context.Context, err error) {
+	whatsappClient.UserLogin.BridgeState.Send(status.BridgeState{
+		StateEvent: status.StateBadCredentials,
+		Error:      WACloudInvalidToken,
+		Message:    err.Error(),
+	})
+
+	if !whatsappClient.badCredentials.CompareAndSwap(false, true) {
+		return
+	}
+
+	zerolog.Ctx(ctx).Error().Err(err).Msg("The access token was rejected, pausing sends")
+
+	var graphError *types.GraphError
+	reason := err.Error()
+	if errors.As(err, &graphError) {
+		reason = graphError.Message
+	}
+	whatsappClient.sendManagementNotice(ctx, fmt.Sprintf(
+		"The access token of the app %s was rejected by Meta: %s\n\n"+
+			"Messages won't be sent to WhatsApp until the access token is replaced.",
+		whatsappClient.UserLogin.ID, reason,
+	))
+}
+
+// updateRemoteProfile saves the number and the verified name of the phone number in the profile
+// of the login, if they changed.
+func (whatsappClient *WhatsappCloudClient) updateRemoteProfile(
+	ctx context.Context, phoneNumber *types.CloudPhoneNumber,
+) {
+	login := whatsappClient.UserLogin
+	profile := status.RemoteProfile{
+		Phone: phoneNumber.DisplayPhoneNumber,
+		Name:  phoneNumber.VerifiedName,
+	}
+	profile = profile.Merge(login.RemoteProfile)
+	if profile == login.RemoteProfile {
+		return
+	}
+
+	login.RemoteProfile = profile
+	err := login.Save(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to save the remote profile of the login")
+	}
+}
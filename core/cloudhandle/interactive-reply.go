@@ -0,0 +1,144 @@
+package cloudhandle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+// InteractiveReplyContentKey is the field of the Matrix message content with the option chosen
+// by the customer in an interactive message or a template button.
+const InteractiveReplyContentKey = "com.ikono.whatsapp.interactive_reply"
+
+// FlowResponseContentKey is the field of the Matrix message content with the answers of a
+// WhatsApp Flow, so they can be read by bots.
+const FlowResponseContentKey = "com.ikono.whatsapp.flow_response"
+
+// convertInteractiveReply converts the option chosen by the customer into a text message that
+// shows its title and ID.
+func convertInteractiveReply(
+	replyType string, id string, title string, description string,
+) *bridgev2.ConvertedMessagePart {
+	body := fmt.Sprintf("%s (ID: %s)", title, id)
+	if description != "" {
+		body += "\n" + description
+	}
+
+	reply := map[string]any{
+		"type":  replyType,
+		"id":    id,
+		"title": title,
+	}
+	if description != "" {
+		reply["description"] = description
+	}
+
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType: event.MsgText,
+			Body:    body,
+		},
+		Extra: map[string]any{InteractiveReplyContentKey: reply},
+	}
+}
+
+// convertFlowResponse converts the answers of a WhatsApp Flow into a text message that lists
+// them. The answers are also kept as JSON in the content of the message.
+func convertFlowResponse(
+	ctx context.Context, flowResponse *types.CloudFlowResponse,
+) *bridgev2.ConvertedMessagePart {
+	lines := []string{flowResponse.Body}
+	if flowResponse.Body == "" {
+		lines[0] = "Flow response"
+	}
+
+	var answers map[string]any
+	err := json.Unmarshal([]byte(flowResponse.ResponseJSON), &answers)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("Failed to parse the answers of the flow")
+	}
+
+	keys := make([]string, 0, len(answers))
+	for key := range answers {
+		// The flow token is only used to identify the flow, it isn't an answer.
+		if key != "flow_token" {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+
+	for _, key := range keys {
+		value, ok := answers[key].(string)
+		if !ok {
+			valueJSON, _ := json.Marshal(answers[key])
+			value = string(valueJSON)
+		}
+		lines = append(lines, fmt.Sprintf("%s: %s", key, value))
+	}
+
+	response := map[string]any{"name": flowResponse.Name}
+	if answers != nil {
+		response["response"] = answers
+	} else {
+		response["response_json"] = flowResponse.ResponseJSON
+	}
+
+	return &bridgev2.ConvertedMessagePart{
+		Type: event.EventMessage,
+		Content: &event.MessageEventContent{
+			MsgType: event.MsgText,
+			Body:    strings.Join(lines, "\n"),
+		},
+		Extra: map[string]any{FlowResponseContentKey: response},
+	}
+}
+
+// convertInteractiveMessage converts the answer of the customer to an interactive message or
+// to a quick reply button of a template.
+func (mc *MessageConverter) convertInteractiveMessage(
+	ctx context.Context, msg *types.CloudValue,
+) (*bridgev2.ConvertedMessagePart, *CloudMessageInfo) {
+	log := zerolog.Ctx(ctx)
+	message := msg.Messages[0]
+
+	if message.Type == "button" {
+		if message.Button == nil {
+			log.Warn().Msg("Button data is empty in the message")
+			return unbridgeablePart("a template button reply"), nil
+		}
+		return convertInteractiveReply(
+			"template_button", message.Button.Payload, message.Button.Text, "",
+		), nil
+	}
+
+	interactive := message.Interactive
+	if interactive == nil {
+		log.Warn().Msg("Interactive data is empty in the message")
+		return unbridgeablePart("an interactive reply"), nil
+	}
+
+	switch {
+	case interactive.Type == "button_reply" && interactive.ButtonReply != nil:
+		reply := interactive.ButtonReply
+		return convertInteractiveReply(interactive.Type, reply.ID, reply.Title, ""), nil
+	case interactive.Type == "list_reply" && interactive.ListReply != nil:
+		reply := interactive.ListReply
+		return convertInteractiveReply(
+			interactive.Type, reply.ID, reply.Title, reply.Description,
+		), nil
+	case interactive.Type == "nfm_reply" && interactive.NfmReply != nil:
+		return convertFlowResponse(ctx, interactive.NfmReply), nil
+	default:
+		log.Warn().Str("interactive_type", interactive.Type).Msg("Unsupported interactive reply")
+		kind := fmt.Sprintf("an interactive reply of type %s", interactive.Type)
+		return unbridgeablePart(kind), nil
+	}
+}
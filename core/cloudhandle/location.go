@@ -0,0 +1,190 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+// staticMapTimeout is the maximum time to wait for the static map renderer.
+const staticMapTimeout = 10 * time.Second
+
+// maxStaticMapSize is the maximum size of the static map images that are downloaded.
+const maxStaticMapSize = 5 * 1024 * 1024
+
+// formatGeoURI builds the geo URI of a location.
+func formatGeoURI(latitude, longitude float64) string {
+	return fmt.Sprintf(
+		"geo:%s,%s",
+		strconv.FormatFloat(latitude, 'f', -1, 64),
+		strconv.FormatFloat(longitude, 'f', -1, 64),
+	)
+}
+
+// parseGeoURI returns the latitude and longitude of a geo URI, ignoring its altitude and
+// parameters, like in geo:37.786971,-122.399677;u=35.
+func parseGeoURI(geoURI string) (float64, float64, error) {
+	coordinates, found := strings.CutPrefix(geoURI, "geo:")
+	if !found {
+		return 0, 0, fmt.Errorf("invalid geo URI: %s", geoURI)
+	}
+
+	coordinates, _, _ = strings.Cut(coordinates, ";")
+	parts := strings.Split(coordinates, ",")
+	if len(parts) < 2 {
+		return 0, 0, fmt.Errorf("invalid geo URI: %s", geoURI)
+	}
+
+	latitude, err := strconv.ParseFloat(strings.TrimSpace(parts[0]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid latitude in geo URI: %w", err)
+	}
+
+	longitude, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid longitude in geo URI: %w", err)
+	}
+
+	return latitude, longitude, nil
+}
+
+// convertLocationMessage converts a WhatsApp Cloud location into an m.location event. The name,
+// address and URL of the location are added to the body.
+func (mc *MessageConverter) convertLocationMessage(
+	ctx context.Context,
+	msg *types.CloudValue,
+	intent bridgev2.MatrixAPI,
+	portal *bridgev2.Portal,
+) (*bridgev2.ConvertedMessagePart, *CloudMessageInfo) {
+	location := msg.Messages[0].Location
+	if location == nil {
+		zerolog.Ctx(ctx).Warn().Msg("Location data is empty in the message")
+		return unbridgeablePart("a location"), nil
+	}
+
+	geoURI := formatGeoURI(location.Latitude, location.Longitude)
+
+	var bodyLines []string
+	for _, line := range []string{location.Name, location.Address, location.URL} {
+		if line != "" {
+			bodyLines = append(bodyLines, line)
+		}
+	}
+	bodyLines = append(bodyLines, geoURI)
+
+	content := &event.MessageEventContent{
+		MsgType: event.MsgLocation,
+		Body:    "Location: " + strings.Join(bodyLines, "\n"),
+		GeoURI:  geoURI,
+	}
+
+	mc.addLocationThumbnail(ctx, content, location, intent, portal)
+
+	return &bridgev2.ConvertedMessagePart{
+		Type:    event.EventMessage,
+		Content: content,
+	}, nil
+}
+
+// addLocationThumbnail adds a static map of the location as the thumbnail of the event, if a
+// static map renderer is configured. Locations are still bridged if the map can't be rendered.
+func (mc *MessageConverter) addLocationThumbnail(
+	ctx context.Context,
+	content *event.MessageEventContent,
+	location *types.CloudLocation,
+	intent bridgev2.MatrixAPI,
+	portal *bridgev2.Portal,
+) {
+	log := zerolog.Ctx(ctx)
+
+	client, ok := ctx.Value(contextKeyClient).(*WhatsappCloudClient)
+	if !ok || client == nil || portal == nil {
+		return
+	}
+
+	staticMapURL := client.Main.Config.WhatsApp.CloudStaticMapURL
+	if staticMapURL == nil || *staticMapURL == "" {
+		return
+	}
+
+	mapURL := strings.NewReplacer(
+		"{latitude}", strconv.FormatFloat(location.Latitude, 'f', -1, 64),
+		"{longitude}", strconv.FormatFloat(location.Longitude, 'f', -1, 64),
+	).Replace(*staticMapURL)
+
+	mapData, err := downloadStaticMap(ctx, mapURL)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to render static map of location")
+		return
+	}
+
+	thumbnail, width, height, err := createThumbnailAndGetSize(mapData, false)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to create thumbnail of static map")
+		return
+	}
+
+	thumbnailURL, thumbnailFile, err := intent.UploadMedia(
+		ctx, portal.MXID, thumbnail, "map.jpg", "image/jpeg",
+	)
+	if err != nil {
+		log.Warn().Err(err).Msg("Failed to upload thumbnail of static map")
+		return
+	}
+
+	content.Info = &event.FileInfo{
+		ThumbnailURL:  thumbnailURL,
+		ThumbnailFile: thumbnailFile,
+		ThumbnailInfo: &event.FileInfo{
+			MimeType: "image/jpeg",
+			Width:    width,
+			Height:   height,
+			Size:     len(thumbnail),
+		},
+	}
+}
+
+// downloadStaticMap gets the image of a static map from the renderer.
+func downloadStaticMap(ctx context.Context, mapURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, staticMapTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, mapURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create HTTP request: %w", err)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxStaticMapSize))
+}
+
+// prepareLocationMessage builds the location object of a Matrix m.location event.
+func prepareLocationMessage(content *event.MessageEventContent) (map[string]interface{}, error) {
+	latitude, longitude, err := parseGeoURI(content.GeoURI)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"latitude":  latitude,
+		"longitude": longitude,
+	}, nil
+}
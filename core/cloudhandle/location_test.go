@@ -0,0 +1,54 @@
+package cloudhandle
+
+import "testing"
+
+func TestParseGeoURI(t *testing.T) {
+	tests := []struct {
+		geoURI    string
+		latitude  float64
+		longitude float64
+		wantErr   bool
+	}{
+		{geoURI: "geo:37.786971,-122.399677", latitude: 37.786971, longitude: -122.399677},
+		{geoURI: "geo:37.786971,-122.399677;u=35", latitude: 37.786971, longitude: -122.399677},
+		{geoURI: "geo:4.60971,-74.08175,2640", latitude: 4.60971, longitude: -74.08175},
+		{geoURI: "geo: 4.6 , -74.1 ", latitude: 4.6, longitude: -74.1},
+		{geoURI: "geo:0,0", latitude: 0, longitude: 0},
+		{geoURI: "37.786971,-122.399677", wantErr: true},
+		{geoURI: "geo:37.786971", wantErr: true},
+		{geoURI: "geo:north,-122.399677", wantErr: true},
+		{geoURI: "geo:37.786971,west", wantErr: true},
+		{geoURI: "", wantErr: true},
+	}
+
+	for _, test := range tests {
+		latitude, longitude, err := parseGeoURI(test.geoURI)
+		if test.wantErr {
+			if err == nil {
+				t.Errorf("parseGeoURI(%q) error = nil, want an error", test.geoURI)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("parseGeoURI(%q) error = %v", test.geoURI, err)
+		} else if latitude != test.latitude || longitude != test.longitude {
+			t.Errorf(
+				"parseGeoURI(%q) = %v, %v, want %v, %v",
+				test.geoURI, latitude, longitude, test.latitude, test.longitude,
+			)
+		}
+	}
+}
+
+func TestGeoURIRoundTrip(t *testing.T) {
+	for _, coordinates := range [][2]float64{{37.786971, -122.399677}, {-33.8688, 151.2093}} {
+		latitude, longitude, err := parseGeoURI(formatGeoURI(coordinates[0], coordinates[1]))
+		if err != nil || latitude != coordinates[0] || longitude != coordinates[1] {
+			t.Errorf(
+				"parseGeoURI(formatGeoURI(%v, %v)) = %v, %v, %v",
+				coordinates[0], coordinates[1], latitude, longitude, err,
+			)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package cloudhandle
 
 import (
 	"context"
+	"sync"
+	"sync/atomic"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
 	"github.com/iKonoTelecomunicaciones/go/format"
@@ -34,6 +36,11 @@ type MessageConverter struct {
 type WhatsappCloudClient struct {
 	Main      *WhatsappCloudConnector
 	UserLogin *bridgev2.UserLogin
+
+	// badCredentials is set when the Graph API rejects the access token of the login.
+	badCredentials  atomic.Bool
+	healthCheckLock sync.Mutex
+	stopHealthCheck context.CancelFunc
 }
 
 func (whatsappClient *WhatsappCloudClient) GetMetaData(
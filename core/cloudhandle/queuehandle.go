@@ -2,22 +2,17 @@ package cloudhandle
 
 import (
 	"context"
+	"errors"
 	"fmt"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/database"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/exmime"
 )
 
-type MediaResponse struct {
-	ID               *string `json:"id"`
-	MessagingProduct *string `json:"messaging_product"`
-	URL              *string `json:"url"`
-	MimeType         *string `json:"mime_type"`
-	Hash             *string `json:"hash"`
-	FileSize         *int    `json:"file_size"`
-	Error            *string `json:"error"`
-}
-
 func (whatsappClient *WhatsappCloudClient) QueueEvent(
 	ctx context.Context,
 	event bridgev2.RemoteEvent,
@@ -36,84 +31,155 @@ func (whatsappClient *WhatsappCloudClient) QueueEvent(
 	log.Info().Interface("event", event).
 		Msgf("Handling remote event in portal %s", portal.PortalKey.ID)
 
-	event.(*WAMessageEvent).parsedMessageType = message.Text.Body
-
 	whatsappClient.UserLogin.QueueRemoteEvent(event)
 }
 
+// QueueReactionEvent queues a reaction of the customer. Reactions without an emoji remove the
+// previous reaction of the customer on the message.
+func (whatsappClient *WhatsappCloudClient) QueueReactionEvent(
+	ctx context.Context,
+	event bridgev2.RemoteEvent,
+	message types.CloudMessage,
+	portal *bridgev2.Portal,
+) error {
+	log := zerolog.Ctx(ctx)
+
+	if message.Reaction == nil || message.Reaction.MessageID == "" {
+		log.Warn().Msg("Reaction data or target message ID is empty in the message")
+		return fmt.Errorf(
+			"%w: reaction data or target message ID is empty in message %s",
+			ErrPermanentFailure, message.ID,
+		)
+	}
+
+	target, err := whatsappClient.findMessage(ctx, portal, message.Reaction.MessageID)
+	if err != nil {
+		return fmt.Errorf("failed to get target of reaction %s: %w", message.ID, err)
+	} else if target == nil {
+		log.Warn().Str("target_message_id", message.Reaction.MessageID).
+			Msg("Ignoring reaction because the target message wasn't found")
+		return nil
+	}
+
+	originalEvent := event.(*WAMessageEvent)
+	originalEvent.targetMessage = target.ID
+	originalEvent.parsedMessageType = "reaction"
+	if message.Reaction.Emoji == "" {
+		originalEvent.parsedMessageType = "reaction remove"
+	}
+	originalEvent.Message = types.CloudValue{
+		MessagingProduct: originalEvent.Message.MessagingProduct,
+		Metadata:         originalEvent.Message.Metadata,
+		Contacts:         originalEvent.Message.Contacts,
+		Messages:         []types.CloudMessage{message},
+	}
+
+	whatsappClient.UserLogin.QueueRemoteEvent(originalEvent)
+	return nil
+}
+
+// findMessage returns the bridged message with the given WhatsApp ID in the portal. The messages
+// sent from Matrix use the login as their sender, while the customer messages use the chat.
+func (whatsappClient *WhatsappCloudClient) findMessage(
+	ctx context.Context, portal *bridgev2.Portal, cloudMessageID string,
+) (*database.Message, error) {
+	chatJID, err := waid.ParsePortalID(portal.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sender := range []string{string(whatsappClient.UserLogin.ID), chatJID} {
+		message, err := whatsappClient.Main.Bridge.DB.Message.GetFirstPartByID(
+			ctx, portal.Receiver, waid.MakeMessageID(chatJID, sender, cloudMessageID),
+		)
+		if err != nil || message != nil {
+			return message, err
+		}
+	}
+
+	return nil, nil
+}
+
+// QueueMediaEvent uploads the media of a customer message to the homeserver and queues the
+// message. An error is returned if the media couldn't be bridged, so the message can be retried.
 func (whatsappClient *WhatsappCloudClient) QueueMediaEvent(
 	ctx context.Context,
 	event bridgev2.RemoteEvent,
 	message types.CloudMessage,
 	portal *bridgev2.Portal,
-) {
+) error {
 	log := whatsappClient.UserLogin.Log
 
 	if portal == nil {
 		log.Warn().
 			Interface("portal_key", event).
 			Msg("Portal not found to handle remote event")
-		return
+		return fmt.Errorf("portal not found for media message %s", message.ID)
 	}
 
 	log.Info().Interface("event", event).
 		Msgf("Handling remote event in portal %s", portal.PortalKey.ID)
 
-	var media_id *string
+	media := message.GetMedia()
+	if media == nil || media.ID == "" {
+		log.Warn().Str("message_type", message.Type).
+			Msg("Media data or media ID is empty in the message")
+		return fmt.Errorf(
+			"%w: media data or media ID is empty in message %s", ErrPermanentFailure, message.ID,
+		)
+	}
 
-	switch message.Type {
-	case "image":
-		if message.Image == nil || message.Image.ID == "" {
-			log.Warn().Msg("Image data is empty or Image ID is empty in the message")
-			return
+	mediaInfo, mediaBody, err := whatsappClient.GetMediaFromMeta(ctx, media.ID)
+	if err != nil {
+		log.Error().Err(err).Msgf("Failed to fetch %s from Meta", message.Type)
+		errorMessage := fmt.Sprintf("Error getting media from Meta, %v", err)
+		err = fmt.Errorf("failed to fetch %s %s from Meta: %w", message.Type, message.ID, err)
+		if errors.Is(err, errFileTooBig) {
+			err = fmt.Errorf("%w: %w", ErrPermanentFailure, err)
+		}
+		// The notice is only sent once, not on every attempt to handle the message.
+		if !willRetry(ctx, err) {
+			whatsappClient.sendMediaUploadFailedNotice(ctx, portal, errorMessage)
 		}
-		media_id = &message.Image.ID
+		return err
+	}
+	defer mediaBody.Close()
 
-	default:
-		log.Warn().Str("message_type", message.Type).Msg("Unsupported media type")
-		return
+	if mediaInfo.MimeType == "" {
+		mediaInfo.MimeType = media.MimeType
 	}
 
-	mediaData, err := whatsappClient.GetMediaFromMeta(ctx, *media_id)
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to fetch image from Meta")
-		errorMessage := fmt.Sprintf("Error getting media from Meta, %v", err)
-		whatsappClient.sendMediaUploadFailedNotice(ctx, portal, errorMessage)
-		return
+	expectedSHA256 := media.SHA256
+	if expectedSHA256 == "" {
+		expectedSHA256 = mediaInfo.Hash
 	}
 
-	mxcURL, err := whatsappClient.UploadMediaToSynapseV3(ctx, mediaData, portal)
+	fileName := message.Type + exmime.ExtensionFromMimetype(mediaInfo.MimeType)
+	if media.Filename != "" {
+		fileName = media.Filename
+	}
+
+	uploadedMedia, err := whatsappClient.UploadMediaToSynapseV3(
+		ctx, portal, mediaBody, mediaInfo, fileName, expectedSHA256,
+	)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to upload image to Synapse")
-		return
+		log.Error().Err(err).Msgf("Failed to upload %s to Synapse", message.Type)
+		return fmt.Errorf("failed to upload %s %s to Synapse: %w", message.Type, message.ID, err)
 	}
 
 	originalEvent := event.(*WAMessageEvent)
-	originalEvent.preuploadedMXC = mxcURL
+	originalEvent.preuploadedMedia = uploadedMedia
 	originalEvent.Message = types.CloudValue{
 		MessagingProduct: originalEvent.Message.MessagingProduct,
 		Metadata:         originalEvent.Message.Metadata,
 		Contacts:         originalEvent.Message.Contacts,
-		Messages: []types.CloudMessage{
-			{
-				From:      message.From,
-				ID:        message.ID,
-				Type:      message.Type,
-				TimeStamp: message.TimeStamp,
-				Image: &types.ImageCloud{
-					ID:       message.Image.ID,
-					MimeType: message.Image.MimeType,
-					SHA256:   message.Image.SHA256,
-					Caption:  message.Image.Caption,
-				},
-			},
-		},
+		Messages:         []types.CloudMessage{message},
 	}
 
 	log.Info().Str(
-		"mxc_url", mxcURL,
-	).Msg("Image processed and uploaded successfully, preparing to enqueue event")
+		"mxc_url", string(uploadedMedia.MXC),
+	).Msg("Media processed and uploaded successfully, preparing to enqueue event")
 
 	whatsappClient.UserLogin.QueueRemoteEvent(originalEvent)
-	return
+	return nil
 }
@@ -0,0 +1,83 @@
+package cloudhandle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/database"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/variationselector"
+)
+
+var _ bridgev2.ReactionHandlingNetworkAPI = (*WhatsappCloudClient)(nil)
+
+// PreHandleMatrixReaction uses the login as the sender of every Matrix reaction, because all the
+// agents share the business number and WhatsApp only keeps one reaction per user on each message.
+func (whatsappClient *WhatsappCloudClient) PreHandleMatrixReaction(
+	_ context.Context, msg *bridgev2.MatrixReaction,
+) (bridgev2.MatrixReactionPreResponse, error) {
+	return bridgev2.MatrixReactionPreResponse{
+		SenderID:     networkid.UserID(whatsappClient.UserLogin.ID),
+		EmojiID:      "",
+		Emoji:        variationselector.FullyQualify(msg.Content.RelatesTo.Key),
+		MaxReactions: 1,
+	}, nil
+}
+
+// sendReaction sends a reaction to a message of the portal. An empty emoji removes the reaction.
+func (whatsappClient *WhatsappCloudClient) sendReaction(
+	ctx context.Context, portal *bridgev2.Portal, targetID networkid.MessageID, emoji string,
+) error {
+	parsedID, err := waid.ParseMessageID(targetID)
+	if err != nil {
+		return fmt.Errorf("failed to parse target message ID: %w", err)
+	}
+
+	reactionData := map[string]interface{}{
+		"message_id": parsedID.ID,
+		"emoji":      emoji,
+	}
+
+	_, err = whatsappClient.sendCloudMessage(
+		ctx, string(portal.Receiver), "", "reaction", reactionData,
+	)
+	if err != nil {
+		var graphError *types.GraphError
+		if errors.As(err, &graphError) {
+			whatsappClient.sendErrorNotice(
+				ctx, portal, graphError.Code, graphError.Title(), graphError.Details(),
+			)
+		}
+		return err
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("target_message_id", parsedID.ID).Str("emoji", emoji).
+		Msg("Reaction sent to WhatsApp")
+	return nil
+}
+
+// HandleMatrixReaction sends a Matrix reaction to WhatsApp as a reaction message.
+func (whatsappClient *WhatsappCloudClient) HandleMatrixReaction(
+	ctx context.Context, msg *bridgev2.MatrixReaction,
+) (*database.Reaction, error) {
+	err := whatsappClient.sendReaction(ctx, msg.Portal, msg.TargetMessage.ID, msg.PreHandleResp.Emoji)
+	if err != nil {
+		return nil, err
+	}
+
+	return &database.Reaction{
+		Metadata: &waid.ReactionMetadata{},
+	}, nil
+}
+
+// HandleMatrixReactionRemove removes a reaction in WhatsApp by sending an empty emoji.
+func (whatsappClient *WhatsappCloudClient) HandleMatrixReactionRemove(
+	ctx context.Context, msg *bridgev2.MatrixReactionRemove,
+) error {
+	return whatsappClient.sendReaction(ctx, msg.Portal, msg.TargetReaction.MessageID, "")
+}
@@ -0,0 +1,182 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/database"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+)
+
+// maxReadReceiptAge is how far back the messages are searched when marking them as read.
+// Meta only accepts read receipts for messages of the last 30 days.
+const maxReadReceiptAge = 30 * 24 * time.Hour
+
+// typingMessageSearchLimit is how many recent messages are searched for the last customer one.
+const typingMessageSearchLimit = 50
+
+var (
+	_ bridgev2.ReadReceiptHandlingNetworkAPI = (*WhatsappCloudClient)(nil)
+	_ bridgev2.TypingHandlingNetworkAPI      = (*WhatsappCloudClient)(nil)
+)
+
+// getAppSetting returns the setting of the app of the login if it's overridden, or the setting
+// of the bridge otherwise. Settings that aren't configured are enabled.
+func (whatsappClient *WhatsappCloudClient) getAppSetting(
+	bridgeSetting *bool, getAppSetting func(AppSettingsConfig) *bool,
+) bool {
+	appSettings := whatsappClient.Main.Config.WhatsApp.CloudAppSettings
+	if settings, ok := appSettings[string(whatsappClient.UserLogin.ID)]; ok {
+		if appSetting := getAppSetting(settings); appSetting != nil {
+			return *appSetting
+		}
+	}
+	return bridgeSetting == nil || *bridgeSetting
+}
+
+func (whatsappClient *WhatsappCloudClient) readReceiptsEnabled() bool {
+	return whatsappClient.getAppSetting(
+		whatsappClient.Main.Config.WhatsApp.CloudSendReadReceipts,
+		func(settings AppSettingsConfig) *bool { return settings.SendReadReceipts },
+	)
+}
+
+func (whatsappClient *WhatsappCloudClient) typingEnabled() bool {
+	return whatsappClient.getAppSetting(
+		whatsappClient.Main.Config.WhatsApp.CloudSendTyping,
+		func(settings AppSettingsConfig) *bool { return settings.SendTyping },
+	)
+}
+
+// getInboundMessageID returns the WhatsApp ID of a message if it was sent by the customer.
+// The messages of the customer use the chat as the sender of their IDs.
+func getInboundMessageID(message *database.Message) string {
+	parsedID, err := waid.ParseMessageID(message.ID)
+	if err != nil || parsedID.Sender != parsedID.Chat {
+		return ""
+	}
+	return parsedID.ID
+}
+
+// sendCloudReadStatus sends a status of a customer message, like read or typing, to WhatsApp.
+func (whatsappClient *WhatsappCloudClient) sendCloudReadStatus(
+	ctx context.Context, data map[string]interface{},
+) error {
+	metadata := whatsappClient.GetMetaData(ctx)
+	statusURL := whatsappClient.Main.GraphURL(metadata.BusinessPhoneID, "messages")
+	data["messaging_product"] = "whatsapp"
+
+	var respData types.CloudSuccessResponse
+	err := whatsappClient.graphJSONRequest(ctx, http.MethodPost, statusURL, data, &respData)
+	if err != nil {
+		return err
+	}
+
+	if !respData.Success {
+		return fmt.Errorf("the message status wasn't accepted")
+	}
+
+	return nil
+}
+
+// HandleMatrixReadReceipt marks the last customer message read by the agent as read in WhatsApp.
+// Marking a message as read also marks all the previous messages of the chat as read.
+func (whatsappClient *WhatsappCloudClient) HandleMatrixReadReceipt(
+	ctx context.Context, receipt *bridgev2.MatrixReadReceipt,
+) error {
+	if !whatsappClient.readReceiptsEnabled() {
+		return nil
+	}
+
+	log := zerolog.Ctx(ctx)
+
+	messageID := ""
+	if receipt.ExactMessage != nil {
+		messageID = getInboundMessageID(receipt.ExactMessage)
+	}
+
+	if messageID == "" {
+		start := receipt.LastRead
+		if oldest := receipt.ReadUpTo.Add(-maxReadReceiptAge); start.Before(oldest) {
+			start = oldest
+		}
+
+		messages, err := whatsappClient.Main.Bridge.DB.Message.GetMessagesBetweenTimeQuery(
+			ctx, receipt.Portal.PortalKey, start, receipt.ReadUpTo,
+		)
+		if err != nil {
+			return fmt.Errorf("failed to get the read messages: %w", err)
+		}
+
+		var lastTimestamp time.Time
+		for _, message := range messages {
+			inboundID := getInboundMessageID(message)
+			if inboundID != "" && !message.Timestamp.Before(lastTimestamp) {
+				messageID = inboundID
+				lastTimestamp = message.Timestamp
+			}
+		}
+	}
+
+	if messageID == "" {
+		log.Debug().Msg("No customer message to mark as read")
+		return nil
+	}
+
+	err := whatsappClient.sendCloudReadStatus(ctx, map[string]interface{}{
+		"status":     "read",
+		"message_id": messageID,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to mark message %s as read: %w", messageID, err)
+	}
+
+	log.Debug().Str("message_id", messageID).Msg("Marked customer message as read")
+	return nil
+}
+
+// HandleMatrixTyping shows the typing indicator to the customer. WhatsApp hides it after 25
+// seconds or when a message is sent, so stopping to type doesn't send anything.
+func (whatsappClient *WhatsappCloudClient) HandleMatrixTyping(
+	ctx context.Context, typing *bridgev2.MatrixTyping,
+) error {
+	if !typing.IsTyping || !whatsappClient.typingEnabled() {
+		return nil
+	}
+
+	// The typing indicator is attached to the last message of the customer.
+	messages, err := whatsappClient.Main.Bridge.DB.Message.GetLastNInPortal(
+		ctx, typing.Portal.PortalKey, typingMessageSearchLimit,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to get the last messages of the portal: %w", err)
+	}
+
+	messageID := ""
+	for _, message := range messages {
+		if messageID = getInboundMessageID(message); messageID != "" {
+			break
+		}
+	}
+
+	if messageID == "" {
+		zerolog.Ctx(ctx).Debug().Msg("No customer message to show the typing indicator")
+		return nil
+	}
+
+	err = whatsappClient.sendCloudReadStatus(ctx, map[string]interface{}{
+		"status":           "read",
+		"message_id":       messageID,
+		"typing_indicator": map[string]interface{}{"type": "text"},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send typing indicator: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package cloudhandle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+// errSessionWindowClosed is returned when a message can't be sent because the session window is
+// closed. The notices of these errors are already sent to the portal.
+var errSessionWindowClosed = errors.New("the 24-hour customer service window is closed")
+
+// isSessionWindowError checks if a Graph API error was caused by the session window being closed.
+// The codes 1004 to 1007 are the ones described in the error_codes config.
+func isSessionWindowError(err error) bool {
+	var graphError *types.GraphError
+	if !errors.As(err, &graphError) {
+		return false
+	}
+	return graphError.Code == sessionWindowErrorCode ||
+		(graphError.Code >= 1004 && graphError.Code <= 1007)
+}
+
+// getApp returns the app of the login of the client.
+func (whatsappClient *WhatsappCloudClient) getApp(
+	ctx context.Context,
+) (*whatsappclouddb.CloudRequest, error) {
+	apps, err := whatsappClient.Main.DB.CloudRequest.SearchApp(
+		ctx, string(whatsappClient.UserLogin.ID), "", "",
+	)
+	if err != nil {
+		return nil, err
+	} else if len(apps) == 0 {
+		return nil, nil
+	}
+	return apps[0], nil
+}
+
+// sendReengagementTemplate sends the re-engagement template of the app instead of a message that
+// can't be sent because the session window is closed. The text of the message is used as the body
+// parameter if the template has one. The agents are told in the room what the customer got.
+func (whatsappClient *WhatsappCloudClient) sendReengagementTemplate(
+	ctx context.Context, msg *bridgev2.MatrixMessage,
+) (string, error) {
+	log := zerolog.Ctx(ctx)
+
+	app, err := whatsappClient.getApp(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get the app to choose the re-engagement template")
+	}
+
+	if app == nil || app.ReengagementTemplate == "" {
+		whatsappClient.sendSessionWindowClosedNotice(ctx, msg.Portal)
+		return "", errSessionWindowClosed
+	}
+
+	templateMessage := &types.CloudTemplateMessage{
+		Name:     app.ReengagementTemplate,
+		Language: app.ReengagementLanguage,
+	}
+
+	template, err := whatsappClient.getSendableTemplate(
+		ctx, templateMessage.Name, templateMessage.Language,
+	)
+	if err == nil {
+		for _, component := range template.Components {
+			isBody := strings.EqualFold(component.Type, "BODY")
+			if isBody && len(templatePlaceholders(component.Text)) == 1 {
+				// Media messages only have text if they have a caption.
+				text := msg.Content.Body
+				if slices.Contains(matrixMediaTypes, msg.Content.MsgType) {
+					text = msg.Content.GetCaption()
+				}
+				templateMessage.Parameters = []string{text}
+			}
+		}
+	}
+
+	messageID, renderedText, err := whatsappClient.SendTemplate(
+		ctx, msg.Portal, templateMessage, getReplyToID(msg.ReplyTo),
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to send the re-engagement template")
+		whatsappClient.sendSessionWindowClosedNotice(ctx, msg.Portal)
+		return "", fmt.Errorf(
+			"%w: failed to send re-engagement template: %w", errSessionWindowClosed, err,
+		)
+	}
+
+	log.Info().Str("template_name", templateMessage.Name).
+		Msg("Sent the re-engagement template because the session window is closed")
+
+	whatsappClient.sendPortalNotice(ctx, msg.Portal, fmt.Sprintf(
+		"The 24-hour customer service window of this chat is closed, so the customer got the "+
+			"re-engagement template %q (%s) instead:\n\n%s",
+		templateMessage.Name, templateMessage.Language, renderedText,
+	))
+
+	return messageID, nil
+}
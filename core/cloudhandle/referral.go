@@ -0,0 +1,117 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/jsontime"
+)
+
+// ReferralContentKey is the field of the Matrix notice content with the referral of the
+// conversation.
+const ReferralContentKey = "com.ikono.whatsapp.referral"
+
+// StateReferral is the state event that shows the ad or post that started the conversation.
+var StateReferral = event.Type{
+	Type:  "com.ikono.whatsapp.referral",
+	Class: event.StateEventType,
+}
+
+// recordReferral saves the referral of a customer message in the portal, so the conversation
+// can be attributed to the ad or post that started it.
+func (whatsappClient *WhatsappCloudClient) recordReferral(
+	ctx context.Context, portal *bridgev2.Portal, message types.CloudMessage,
+) {
+	metadata, ok := portal.Metadata.(*waid.PortalMetadata)
+	if !ok || message.Referral == nil {
+		return
+	}
+
+	metadata.Referral = &waid.PortalReferral{
+		CloudReferral: *message.Referral,
+		MessageID:     message.ID,
+		ReceivedAt:    jsontime.U(parseCloudTimestamp(message.TimeStamp)),
+	}
+
+	err := portal.Save(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to save the referral of the portal")
+	}
+}
+
+// formatReferralNotice builds the notice that shows the referral to the agents.
+func formatReferralNotice(referral *types.CloudReferral) string {
+	source, sourceLabel := "an ad", "Ad"
+	if referral.SourceType != "ad" {
+		source, sourceLabel = "a post", "Post"
+	}
+
+	lines := []string{fmt.Sprintf("The customer started this conversation from %s", source)}
+	if referral.Headline != "" {
+		lines = append(lines, "Headline: "+referral.Headline)
+	}
+	if referral.Body != "" {
+		lines = append(lines, "Text: "+referral.Body)
+	}
+	if referral.SourceURL != "" {
+		lines = append(lines, "Source: "+referral.SourceURL)
+	}
+	if referral.SourceID != "" {
+		lines = append(lines, fmt.Sprintf("%s ID: %s", sourceLabel, referral.SourceID))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// sendReferralNotice sends the referral of a customer message to the room as a bot notice shown
+// before the message, and updates the referral state of the room.
+func (whatsappClient *WhatsappCloudClient) sendReferralNotice(
+	ctx context.Context, portal *bridgev2.Portal, referral *types.CloudReferral,
+) {
+	log := zerolog.Ctx(ctx)
+	whatsappClient.updateReferralState(ctx, portal)
+
+	if portal.MXID == "" {
+		log.Warn().Msg("Can't send the referral notice because the portal has no room")
+		return
+	}
+
+	content := &event.Content{
+		Parsed: &event.MessageEventContent{
+			MsgType: event.MsgNotice,
+			Body:    formatReferralNotice(referral),
+		},
+		Raw: map[string]any{ReferralContentKey: referral},
+	}
+
+	_, err := whatsappClient.Main.Bridge.Bot.SendMessage(
+		ctx, portal.MXID, event.EventMessage, content, nil,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to send the referral notice")
+	}
+}
+
+// updateReferralState sends the referral of the portal to its room.
+func (whatsappClient *WhatsappCloudClient) updateReferralState(
+	ctx context.Context, portal *bridgev2.Portal,
+) {
+	metadata, ok := portal.Metadata.(*waid.PortalMetadata)
+	if !ok || metadata.Referral == nil || portal.MXID == "" {
+		return
+	}
+
+	_, err := whatsappClient.Main.Bridge.Bot.SendState(
+		ctx, portal.MXID, StateReferral, "", &event.Content{Parsed: metadata.Referral}, time.Time{},
+	)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to update the referral state")
+	}
+}
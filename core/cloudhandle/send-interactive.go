@@ -0,0 +1,339 @@
+package cloudhandle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+)
+
+// InteractiveContentKey is the field of the Matrix message content used to send an interactive
+// message, like reply buttons or a list.
+const InteractiveContentKey = "com.ikono.whatsapp.interactive"
+
+// Limits of the interactive messages documented by Meta.
+const (
+	maxInteractiveBody        = 1024
+	maxInteractiveButtons     = 3
+	maxInteractiveButtonTitle = 20
+	maxInteractiveRows        = 10
+	maxInteractiveRowTitle    = 24
+	maxInteractiveRowDesc     = 72
+	maxInteractiveSections    = 10
+	maxInteractiveSectionName = 24
+)
+
+var _ bridgev2.PollHandlingNetworkAPI = (*WhatsappCloudClient)(nil)
+
+// getInteractiveMessage returns the validated interactive message in the content of a Matrix
+// event, if it has one.
+func getInteractiveMessage(evt *event.Event) (*types.CloudInteractive, error) {
+	if evt == nil || evt.Content.Raw == nil {
+		return nil, nil
+	}
+
+	rawInteractive, ok := evt.Content.Raw[InteractiveContentKey]
+	if !ok || rawInteractive == nil {
+		return nil, nil
+	}
+
+	interactiveData, err := json.Marshal(rawInteractive)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s field: %w", InteractiveContentKey, err)
+	}
+
+	var interactive types.CloudInteractive
+	err = json.Unmarshal(interactiveData, &interactive)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s field: %w", InteractiveContentKey, err)
+	}
+
+	err = validateInteractive(&interactive)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s field: %w", InteractiveContentKey, err)
+	}
+
+	return &interactive, nil
+}
+
+// checkLength fails if a text of an interactive message is empty or longer than the limit.
+func checkLength(name string, text string, limit int) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("the %s can't be empty", name)
+	} else if utf8.RuneCountInString(text) > limit {
+		return fmt.Errorf("the %s can't be longer than %d characters", name, limit)
+	}
+	return nil
+}
+
+// validateInteractive checks an interactive message against the limits of WhatsApp and fills
+// the fields that only have one valid value.
+func validateInteractive(interactive *types.CloudInteractive) error {
+	if interactive.Body == nil {
+		return fmt.Errorf("the body is required")
+	} else if err := checkLength("body", interactive.Body.Text, maxInteractiveBody); err != nil {
+		return err
+	}
+
+	if interactive.Action == nil {
+		interactive.Action = &types.CloudInteractiveAction{}
+	}
+	action := interactive.Action
+
+	switch interactive.Type {
+	case "button":
+		if len(action.Buttons) == 0 || len(action.Buttons) > maxInteractiveButtons {
+			return fmt.Errorf("button messages need 1 to %d buttons", maxInteractiveButtons)
+		}
+
+		ids := map[string]bool{}
+		for i := range action.Buttons {
+			button := &action.Buttons[i]
+			button.Type = "reply"
+			err := checkLength("button title", button.Reply.Title, maxInteractiveButtonTitle)
+			if err != nil {
+				return err
+			}
+			if button.Reply.ID == "" {
+				button.Reply.ID = button.Reply.Title
+			}
+			if ids[button.Reply.ID] {
+				return fmt.Errorf("the button ID %s is repeated", button.Reply.ID)
+			}
+			ids[button.Reply.ID] = true
+		}
+
+	case "list":
+		err := checkLength("list button", action.Button, maxInteractiveButtonTitle)
+		if err != nil {
+			return err
+		} else if len(action.Sections) == 0 || len(action.Sections) > maxInteractiveSections {
+			return fmt.Errorf("list messages need 1 to %d sections", maxInteractiveSections)
+		}
+
+		rows := 0
+		ids := map[string]bool{}
+		for i := range action.Sections {
+			section := &action.Sections[i]
+			if len(action.Sections) > 1 {
+				err = checkLength("section title", section.Title, maxInteractiveSectionName)
+				if err != nil {
+					return err
+				}
+			}
+
+			for j := range section.Rows {
+				row := &section.Rows[j]
+				err = checkLength("row title", row.Title, maxInteractiveRowTitle)
+				if err != nil {
+					return err
+				} else if utf8.RuneCountInString(row.Description) > maxInteractiveRowDesc {
+					return fmt.Errorf(
+						"the row description can't be longer than %d characters",
+						maxInteractiveRowDesc,
+					)
+				}
+				if row.ID == "" {
+					row.ID = row.Title
+				}
+				if ids[row.ID] {
+					return fmt.Errorf("the row ID %s is repeated", row.ID)
+				}
+				ids[row.ID] = true
+				rows++
+			}
+		}
+
+		if rows == 0 || rows > maxInteractiveRows {
+			return fmt.Errorf("list messages need 1 to %d rows", maxInteractiveRows)
+		}
+
+	case "cta_url":
+		action.Name = "cta_url"
+		if action.Parameters == nil || action.Parameters.URL == "" {
+			return fmt.Errorf("call-to-action messages need a URL")
+		}
+		err := checkLength(
+			"call-to-action text", action.Parameters.DisplayText, maxInteractiveButtonTitle,
+		)
+		if err != nil {
+			return err
+		}
+
+	case "location_request_message":
+		action.Name = "send_location"
+
+	default:
+		return fmt.Errorf("unsupported interactive message type: %s", interactive.Type)
+	}
+
+	if interactive.Header != nil && interactive.Header.Type == "" {
+		interactive.Header.Type = "text"
+	} else if interactive.Header != nil && interactive.Header.Type != "text" {
+		return fmt.Errorf("only text headers are supported")
+	}
+
+	return nil
+}
+
+// formatInteractiveFallback builds the readable text of an interactive message shown in Matrix.
+func formatInteractiveFallback(interactive *types.CloudInteractive) string {
+	var parts []string
+	if interactive.Header != nil && interactive.Header.Text != "" {
+		parts = append(parts, interactive.Header.Text)
+	}
+	parts = append(parts, interactive.Body.Text)
+	if interactive.Footer != nil && interactive.Footer.Text != "" {
+		parts = append(parts, interactive.Footer.Text)
+	}
+
+	action := interactive.Action
+	switch interactive.Type {
+	case "button":
+		buttons := make([]string, 0, len(action.Buttons))
+		for _, button := range action.Buttons {
+			buttons = append(buttons, fmt.Sprintf("[%s]", button.Reply.Title))
+		}
+		parts = append(parts, strings.Join(buttons, " "))
+
+	case "list":
+		lines := []string{fmt.Sprintf("[%s]", action.Button)}
+		for _, section := range action.Sections {
+			if section.Title != "" {
+				lines = append(lines, section.Title+":")
+			}
+			for _, row := range section.Rows {
+				line := "* " + row.Title
+				if row.Description != "" {
+					line += " - " + row.Description
+				}
+				lines = append(lines, line)
+			}
+		}
+		parts = append(parts, strings.Join(lines, "\n"))
+
+	case "cta_url":
+		parameters := action.Parameters
+		parts = append(parts, fmt.Sprintf("[%s](%s)", parameters.DisplayText, parameters.URL))
+
+	case "location_request_message":
+		parts = append(parts, "[Send location]")
+	}
+
+	return strings.Join(parts, "\n\n")
+}
+
+// pollText returns the plain text of a poll question or answer.
+func pollText(message event.MSC1767Message) string {
+	if message.Text != "" {
+		return message.Text
+	}
+	for _, text := range message.Message {
+		if text.MimeType == "" || text.MimeType == "text/plain" {
+			return text.Body
+		}
+	}
+	return ""
+}
+
+// truncateText shortens a text to the given number of characters.
+func truncateText(text string, limit int) string {
+	if utf8.RuneCountInString(text) <= limit {
+		return text
+	}
+	return string([]rune(text)[:limit-1]) + "…"
+}
+
+// pollToInteractive converts a Matrix poll into reply buttons if its answers fit in them, or
+// into a list otherwise.
+func pollToInteractive(content *event.PollStartEventContent) (*types.CloudInteractive, error) {
+	poll := content.PollStart
+	if len(poll.Answers) == 0 || len(poll.Answers) > maxInteractiveRows {
+		return nil, fmt.Errorf("polls need 1 to %d answers to be sent", maxInteractiveRows)
+	}
+
+	interactive := &types.CloudInteractive{
+		Type:   "button",
+		Body:   &types.CloudInteractiveText{Text: pollText(poll.Question)},
+		Action: &types.CloudInteractiveAction{},
+	}
+
+	fitsInButtons := len(poll.Answers) <= maxInteractiveButtons
+	for _, answer := range poll.Answers {
+		if utf8.RuneCountInString(pollText(answer.MSC1767Message)) > maxInteractiveButtonTitle {
+			fitsInButtons = false
+		}
+	}
+
+	if fitsInButtons {
+		for _, answer := range poll.Answers {
+			title := pollText(answer.MSC1767Message)
+			button := types.CloudInteractiveButton{
+				Type:  "reply",
+				Reply: types.CloudInteractiveReply{ID: answer.ID, Title: title},
+			}
+			interactive.Action.Buttons = append(interactive.Action.Buttons, button)
+		}
+	} else {
+		interactive.Type = "list"
+		interactive.Action.Button = "Options"
+		section := types.CloudInteractiveSection{}
+		for _, answer := range poll.Answers {
+			text := pollText(answer.MSC1767Message)
+			row := types.CloudInteractiveRow{
+				ID:    answer.ID,
+				Title: truncateText(text, maxInteractiveRowTitle),
+			}
+			// The full answer is kept in the description if it doesn't fit in the title.
+			if row.Title != text {
+				row.Description = truncateText(text, maxInteractiveRowDesc)
+			}
+			section.Rows = append(section.Rows, row)
+		}
+		interactive.Action.Sections = []types.CloudInteractiveSection{section}
+	}
+
+	err := validateInteractive(interactive)
+	if err != nil {
+		return nil, err
+	}
+
+	return interactive, nil
+}
+
+// HandleMatrixPollStart sends a Matrix poll to WhatsApp as an interactive message. The poll is
+// handled like a message with the interactive field, so the session window is also checked.
+func (whatsappClient *WhatsappCloudClient) HandleMatrixPollStart(
+	ctx context.Context, msg *bridgev2.MatrixPollStart,
+) (*bridgev2.MatrixMessageResponse, error) {
+	interactive, err := pollToInteractive(msg.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	// The event is copied, so the original content isn't changed.
+	evt := *msg.Event
+	evt.Content.Raw = map[string]any{InteractiveContentKey: interactive}
+
+	message := msg.MatrixMessage
+	message.Event = &evt
+	message.Content = &event.MessageEventContent{
+		MsgType: event.MsgText,
+		Body:    formatInteractiveFallback(interactive),
+	}
+
+	return whatsappClient.handleConvertedMatrixMessage(ctx, &message)
+}
+
+// HandleMatrixPollVote rejects the votes of the agents, because the customer is the only one
+// that can answer an interactive message.
+func (whatsappClient *WhatsappCloudClient) HandleMatrixPollVote(
+	_ context.Context, _ *bridgev2.MatrixPollVote,
+) (*bridgev2.MatrixMessageResponse, error) {
+	return nil, bridgev2.ErrUnsupportedMessageType
+}
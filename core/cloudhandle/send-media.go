@@ -0,0 +1,212 @@
+package cloudhandle
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/exmime"
+)
+
+// cloudMediaLimits are the maximum sizes accepted by WhatsApp Cloud for each media type.
+// https://developers.facebook.com/docs/whatsapp/cloud-api/reference/media#supported-media-types
+var cloudMediaLimits = map[string]int64{
+	"image":    5 * 1024 * 1024,
+	"video":    16 * 1024 * 1024,
+	"audio":    16 * 1024 * 1024,
+	"document": 100 * 1024 * 1024,
+	"sticker":  500 * 1024,
+}
+
+// matrixMediaTypes are the Matrix message types that are sent to WhatsApp as media.
+var matrixMediaTypes = []event.MessageType{
+	event.MsgImage,
+	event.MsgVideo,
+	event.MsgAudio,
+	event.MsgFile,
+	event.MessageType(event.EventSticker.Type),
+}
+
+// getCloudMediaType returns the WhatsApp Cloud message type used to send a Matrix media message.
+// WhatsApp only accepts WebP stickers, so other stickers are sent as images.
+func getCloudMediaType(content *event.MessageEventContent) string {
+	switch content.MsgType {
+	case event.MsgImage:
+		return "image"
+	case event.MsgVideo:
+		return "video"
+	case event.MsgAudio:
+		return "audio"
+	case event.MsgFile:
+		return "document"
+	case event.MessageType(event.EventSticker.Type):
+		if content.Info != nil && content.Info.MimeType == "image/webp" {
+			return "sticker"
+		}
+		return "image"
+	default:
+		return ""
+	}
+}
+
+// formatFileSize formats a size in bytes as megabytes or kilobytes for the notices.
+func formatFileSize(size int64) string {
+	if size >= 1024*1024 {
+		return fmt.Sprintf("%.1f MB", float64(size)/(1024*1024))
+	}
+	return fmt.Sprintf("%.1f KB", float64(size)/1024)
+}
+
+// checkMediaSize validates the size of a file against the bridge limit and the limit of
+// WhatsApp Cloud for the media type, sending a notice to the portal if it's too big.
+func (whatsappClient *WhatsappCloudClient) checkMediaSize(
+	ctx context.Context, portal *bridgev2.Portal, cloudMediaType string, size int64,
+) error {
+	limit := cloudMediaLimits[cloudMediaType]
+	maxFileSize := whatsappClient.Main.MsgConv.MaxFileSize
+
+	if maxFileSize > 0 && maxFileSize < limit {
+		limit = maxFileSize
+	}
+
+	if size <= limit {
+		return nil
+	}
+
+	whatsappClient.sendPortalNotice(ctx, portal, fmt.Sprintf(
+		"The file is too big to be sent to WhatsApp (%s), the limit for %s files is %s",
+		formatFileSize(size), cloudMediaType, formatFileSize(limit),
+	))
+
+	return fmt.Errorf(
+		"%s file of %d bytes exceeds the limit of %d bytes", cloudMediaType, size, limit,
+	)
+}
+
+// uploadMedia uploads a file to the media endpoint of the phone number and returns its media ID.
+func (whatsappClient *WhatsappCloudClient) uploadMedia(
+	ctx context.Context, data []byte, mimeType string, fileName string,
+) (string, error) {
+	metadata := whatsappClient.GetMetaData(ctx)
+	uploadURL := whatsappClient.Main.GraphURL(metadata.BusinessPhoneID, "media")
+
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	err := writer.WriteField("messaging_product", "whatsapp")
+	if err != nil {
+		return "", fmt.Errorf("failed to write messaging_product field: %w", err)
+	}
+
+	err = writer.WriteField("type", mimeType)
+	if err != nil {
+		return "", fmt.Errorf("failed to write type field: %w", err)
+	}
+
+	header := textproto.MIMEHeader{}
+	header.Set(
+		"Content-Disposition",
+		fmt.Sprintf(`form-data; name="file"; filename=%q`, fileName),
+	)
+	header.Set("Content-Type", mimeType)
+
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return "", fmt.Errorf("failed to create file field: %w", err)
+	}
+
+	_, err = part.Write(data)
+	if err != nil {
+		return "", fmt.Errorf("failed to write file field: %w", err)
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return "", fmt.Errorf("failed to close multipart body: %w", err)
+	}
+
+	var respData types.CloudMediaUploadResponse
+	err = whatsappClient.graphRequest(
+		ctx, http.MethodPost, uploadURL, writer.FormDataContentType(), &body, &respData,
+	)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload media to WhatsApp: %w", err)
+	}
+
+	if respData.ID == "" {
+		return "", fmt.Errorf("the media upload response doesn't contain the media ID")
+	}
+
+	return respData.ID, nil
+}
+
+// prepareMediaMessage downloads the media of a Matrix message, uploads it to WhatsApp Cloud
+// and returns the media object of the message that will be sent.
+func (whatsappClient *WhatsappCloudClient) prepareMediaMessage(
+	ctx context.Context, msg *bridgev2.MatrixMessage, cloudMediaType string,
+) (map[string]interface{}, error) {
+	log := zerolog.Ctx(ctx)
+	content := msg.Content
+
+	// Check the size announced by the event first to avoid downloading files that can't be sent.
+	if content.Info != nil && content.Info.Size > 0 {
+		err := whatsappClient.checkMediaSize(ctx, msg.Portal, cloudMediaType, int64(content.Info.Size))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := whatsappClient.Main.Bridge.Bot.DownloadMedia(ctx, content.URL, content.File)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
+	}
+
+	err = whatsappClient.checkMediaSize(ctx, msg.Portal, cloudMediaType, int64(len(data)))
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType := ""
+	if content.Info != nil {
+		mimeType = content.Info.MimeType
+	}
+	if mimeType == "" {
+		mimeType = http.DetectContentType(data)
+	}
+
+	fileName := content.GetFileName()
+	if fileName == "" {
+		fileName = cloudMediaType + exmime.ExtensionFromMimetype(mimeType)
+	}
+
+	mediaID, err := whatsappClient.uploadMedia(ctx, data, mimeType, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Debug().Str("media_id", mediaID).Str("mime_type", mimeType).
+		Int("media_size", len(data)).Msg("Media uploaded to WhatsApp")
+
+	mediaData := map[string]interface{}{
+		"id": mediaID,
+	}
+
+	// Audios and stickers can't have captions, and only documents keep their filename.
+	caption := content.GetCaption()
+	if caption != "" && cloudMediaType != "audio" && cloudMediaType != "sticker" {
+		mediaData["caption"] = caption
+	}
+
+	if cloudMediaType == "document" {
+		mediaData["filename"] = fileName
+	}
+
+	return mediaData, nil
+}
@@ -0,0 +1,367 @@
+package cloudhandle
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/go/id"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/exmime"
+)
+
+// TemplateContentKey is the field of the Matrix message content used to send a template.
+const TemplateContentKey = "com.ikono.whatsapp.template"
+
+var templatePlaceholderRegex = regexp.MustCompile(`\{\{\s*([a-zA-Z0-9_]+)\s*\}\}`)
+
+// templateHeaderMediaTypes are the header formats of the templates that need a media parameter.
+var templateHeaderMediaTypes = map[string]string{
+	"IMAGE":    "image",
+	"VIDEO":    "video",
+	"DOCUMENT": "document",
+}
+
+// getTemplateMessage returns the template in the content of a Matrix event, if it has one.
+func getTemplateMessage(evt *event.Event) (*types.CloudTemplateMessage, error) {
+	if evt == nil || evt.Content.Raw == nil {
+		return nil, nil
+	}
+
+	rawTemplate, ok := evt.Content.Raw[TemplateContentKey]
+	if !ok || rawTemplate == nil {
+		return nil, nil
+	}
+
+	templateData, err := json.Marshal(rawTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s field: %w", TemplateContentKey, err)
+	}
+
+	var templateMessage types.CloudTemplateMessage
+	err = json.Unmarshal(templateData, &templateMessage)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s field: %w", TemplateContentKey, err)
+	}
+
+	if templateMessage.Name == "" || templateMessage.Language == "" {
+		return nil, fmt.Errorf("the %s field needs a name and a language", TemplateContentKey)
+	}
+
+	return &templateMessage, nil
+}
+
+// templatePlaceholders returns the distinct placeholders of a template text. Numbered
+// placeholders are sorted by their number and named ones keep the order they appear in.
+func templatePlaceholders(text string) []string {
+	var placeholders []string
+	for _, match := range templatePlaceholderRegex.FindAllStringSubmatch(text, -1) {
+		if !slices.Contains(placeholders, match[1]) {
+			placeholders = append(placeholders, match[1])
+		}
+	}
+
+	slices.SortStableFunc(placeholders, func(a, b string) int {
+		numberA, errA := strconv.Atoi(a)
+		numberB, errB := strconv.Atoi(b)
+		if errA != nil || errB != nil {
+			return 0
+		}
+		return numberA - numberB
+	})
+
+	return placeholders
+}
+
+// renderTemplateText replaces the placeholders of a template text with their values.
+func renderTemplateText(text string, values map[string]string) string {
+	return templatePlaceholderRegex.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := templatePlaceholderRegex.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// templateParameters hands out the parameters of a template message in order.
+type templateParameters struct {
+	values []string
+	used   int
+}
+
+func (params *templateParameters) next() (string, bool) {
+	if params.used >= len(params.values) {
+		params.used++
+		return "", false
+	}
+	params.used++
+	return params.values[params.used-1], true
+}
+
+// textParameters builds the text parameters of the placeholders of a component.
+func (params *templateParameters) textParameters(
+	text string,
+) ([]map[string]interface{}, map[string]string) {
+	var parameters []map[string]interface{}
+	values := map[string]string{}
+
+	for _, placeholder := range templatePlaceholders(text) {
+		value, _ := params.next()
+		values[placeholder] = value
+
+		parameter := map[string]interface{}{"type": "text", "text": value}
+		if _, err := strconv.Atoi(placeholder); err != nil {
+			parameter["parameter_name"] = placeholder
+		}
+		parameters = append(parameters, parameter)
+	}
+
+	return parameters, values
+}
+
+// getSendableTemplate returns the cached template with the given name and language, syncing the
+// templates if it isn't cached. Only approved templates can be sent.
+func (whatsappClient *WhatsappCloudClient) getSendableTemplate(
+	ctx context.Context, name string, language string,
+) (*whatsappclouddb.Template, error) {
+	wabaID := whatsappClient.GetMetaData(ctx).WabaID
+	template, err := whatsappClient.Main.DB.Template.GetByNameAndLanguage(ctx, wabaID, name, language)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get template %s (%s): %w", name, language, err)
+	}
+
+	if template == nil {
+		_, err = whatsappClient.SyncTemplates(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		template, err = whatsappClient.Main.DB.Template.GetByNameAndLanguage(
+			ctx, wabaID, name, language,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template %s (%s): %w", name, language, err)
+		}
+	}
+
+	if template == nil {
+		return nil, fmt.Errorf("template %s (%s) not found", name, language)
+	} else if template.Status != "APPROVED" {
+		return nil, fmt.Errorf(
+			"template %s (%s) can't be sent because its status is %s",
+			name, language, template.Status,
+		)
+	}
+
+	return template, nil
+}
+
+// prepareTemplateHeaderMedia returns the media object of a template header. Matrix files are
+// uploaded through the media endpoint, while other URLs are sent as links.
+func (whatsappClient *WhatsappCloudClient) prepareTemplateHeaderMedia(
+	ctx context.Context, portal *bridgev2.Portal, cloudMediaType string, mediaURL string,
+) (map[string]interface{}, error) {
+	mediaData := map[string]interface{}{}
+
+	if strings.HasPrefix(mediaURL, "mxc://") {
+		data, err := whatsappClient.Main.Bridge.Bot.DownloadMedia(
+			ctx, id.ContentURIString(mediaURL), nil,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", bridgev2.ErrMediaDownloadFailed, err)
+		}
+
+		err = whatsappClient.checkMediaSize(ctx, portal, cloudMediaType, int64(len(data)))
+		if err != nil {
+			return nil, err
+		}
+
+		mimeType := http.DetectContentType(data)
+		fileName := cloudMediaType + exmime.ExtensionFromMimetype(mimeType)
+
+		mediaID, err := whatsappClient.uploadMedia(ctx, data, mimeType, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		mediaData["id"] = mediaID
+		if cloudMediaType == "document" {
+			mediaData["filename"] = fileName
+		}
+	} else if strings.HasPrefix(mediaURL, "https://") || strings.HasPrefix(mediaURL, "http://") {
+		mediaData["link"] = mediaURL
+		if cloudMediaType == "document" {
+			mediaData["filename"] = path.Base(mediaURL)
+		}
+	} else {
+		return nil, fmt.Errorf("invalid %s header URL: %s", cloudMediaType, mediaURL)
+	}
+
+	return mediaData, nil
+}
+
+// prepareTemplateMessage fills the header, body and button parameters of a template with the
+// parameters of the message. It returns the template object that is sent to WhatsApp and the
+// rendered text of the template.
+func (whatsappClient *WhatsappCloudClient) prepareTemplateMessage(
+	ctx context.Context, portal *bridgev2.Portal, templateMessage *types.CloudTemplateMessage,
+) (map[string]interface{}, string, error) {
+	template, err := whatsappClient.getSendableTemplate(
+		ctx, templateMessage.Name, templateMessage.Language,
+	)
+	if err != nil {
+		return nil, "", err
+	}
+
+	params := &templateParameters{values: templateMessage.Parameters}
+	var components []map[string]interface{}
+	var renderedParts []string
+	var renderedButtons []string
+	buttonIndex := 0
+
+	for _, component := range template.Components {
+		switch strings.ToUpper(component.Type) {
+		case "HEADER":
+			format := strings.ToUpper(component.Format)
+			if cloudMediaType, ok := templateHeaderMediaTypes[format]; ok {
+				mediaURL, _ := params.next()
+				mediaData, err := whatsappClient.prepareTemplateHeaderMedia(
+					ctx, portal, cloudMediaType, mediaURL,
+				)
+				if err != nil {
+					return nil, "", err
+				}
+
+				components = append(components, map[string]interface{}{
+					"type": "header",
+					"parameters": []map[string]interface{}{
+						{"type": cloudMediaType, cloudMediaType: mediaData},
+					},
+				})
+				renderedParts = append(renderedParts, fmt.Sprintf("[%s]", strings.ToLower(format)))
+				continue
+			} else if format != "" && format != "TEXT" {
+				return nil, "", fmt.Errorf("unsupported template header format: %s", format)
+			}
+
+			parameters, values := params.textParameters(component.Text)
+			if len(parameters) > 0 {
+				components = append(components, map[string]interface{}{
+					"type":       "header",
+					"parameters": parameters,
+				})
+			}
+			renderedParts = append(renderedParts, renderTemplateText(component.Text, values))
+
+		case "BODY":
+			parameters, values := params.textParameters(component.Text)
+			if len(parameters) > 0 {
+				components = append(components, map[string]interface{}{
+					"type":       "body",
+					"parameters": parameters,
+				})
+			}
+			renderedParts = append(renderedParts, renderTemplateText(component.Text, values))
+
+		case "FOOTER":
+			renderedParts = append(renderedParts, component.Text)
+
+		case "BUTTONS":
+			for _, button := range component.Buttons {
+				index := strconv.Itoa(buttonIndex)
+				buttonIndex++
+				renderedButtons = append(renderedButtons, fmt.Sprintf("[%s]", button.Text))
+
+				switch strings.ToUpper(button.Type) {
+				case "URL":
+					parameters, _ := params.textParameters(button.URL)
+					if len(parameters) == 0 {
+						continue
+					}
+					components = append(components, map[string]interface{}{
+						"type":       "button",
+						"sub_type":   "url",
+						"index":      index,
+						"parameters": parameters,
+					})
+				case "COPY_CODE":
+					code, _ := params.next()
+					components = append(components, map[string]interface{}{
+						"type":     "button",
+						"sub_type": "copy_code",
+						"index":    index,
+						"parameters": []map[string]interface{}{
+							{"type": "coupon_code", "coupon_code": code},
+						},
+					})
+				}
+			}
+		}
+	}
+
+	if params.used != len(params.values) {
+		return nil, "", fmt.Errorf(
+			"template %s (%s) needs %d parameters, but %d were given",
+			template.Name, template.Language, params.used, len(params.values),
+		)
+	}
+
+	if len(renderedButtons) > 0 {
+		renderedParts = append(renderedParts, strings.Join(renderedButtons, " "))
+	}
+
+	templateData := map[string]interface{}{
+		"name":     template.Name,
+		"language": map[string]interface{}{"code": template.Language},
+	}
+	if len(components) > 0 {
+		templateData["components"] = components
+	}
+
+	return templateData, strings.Join(renderedParts, "\n\n"), nil
+}
+
+// SendTemplate sends a template to the WhatsApp user of the portal as a reply to the given
+// message ID, if it isn't empty. It returns the ID of the sent message and the rendered text of
+// the template.
+func (whatsappClient *WhatsappCloudClient) SendTemplate(
+	ctx context.Context,
+	portal *bridgev2.Portal,
+	templateMessage *types.CloudTemplateMessage,
+	replyToID string,
+) (string, string, error) {
+	log := zerolog.Ctx(ctx).With().
+		Str("template_name", templateMessage.Name).
+		Str("template_language", templateMessage.Language).
+		Logger()
+	ctx = log.WithContext(ctx)
+
+	templateData, renderedText, err := whatsappClient.prepareTemplateMessage(
+		ctx, portal, templateMessage,
+	)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to prepare template message")
+		return "", "", err
+	}
+
+	messageID, err := whatsappClient.sendCloudMessage(
+		ctx, string(portal.Receiver), replyToID, "template", templateData,
+	)
+	if err != nil {
+		return "", "", err
+	}
+
+	log.Info().Str("message_id", messageID).Msg("Template message sent")
+	return messageID, renderedText, nil
+}
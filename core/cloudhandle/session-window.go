@@ -0,0 +1,140 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/event"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
+	"go.mau.fi/util/jsontime"
+)
+
+// sessionWindow is how long free-form messages can be sent after the last customer message.
+// https://developers.facebook.com/docs/whatsapp/cloud-api/guides/send-messages#customer-service-windows
+const sessionWindow = 24 * time.Hour
+
+// sessionWindowErrorCode is the Graph API error returned when the session window is closed.
+const sessionWindowErrorCode = 131047
+
+// StateSessionWindow is the state event that shows the session window of the portal in the room.
+var StateSessionWindow = event.Type{
+	Type:  "com.ikono.whatsapp.session_window",
+	Class: event.StateEventType,
+}
+
+// SessionWindowEventContent is the content of the session window state event. The state is only
+// updated when the customer writes, so clients must compare the current time with ExpiresAt to
+// know if the window is still open.
+type SessionWindowEventContent struct {
+	LastCustomerMessage jsontime.Unix `json:"last_customer_message"`
+	ExpiresAt           jsontime.Unix `json:"expires_at"`
+}
+
+// getSessionWindowExpiry returns when the session window of the portal closes. The zero time is
+// returned if no customer message was recorded yet.
+func getSessionWindowExpiry(portal *bridgev2.Portal) time.Time {
+	metadata, ok := portal.Metadata.(*waid.PortalMetadata)
+	if !ok || metadata.LastCustomerMessage.IsZero() {
+		return time.Time{}
+	}
+	return metadata.LastCustomerMessage.Add(sessionWindow)
+}
+
+// isSessionWindowClosed checks if the session window of the portal is known to be closed.
+// Portals without any recorded customer message are considered open, so the API decides.
+func isSessionWindowClosed(portal *bridgev2.Portal) bool {
+	expiresAt := getSessionWindowExpiry(portal)
+	return !expiresAt.IsZero() && time.Now().After(expiresAt)
+}
+
+// recordCustomerMessage saves the time of a customer message in the portal, which reopens its
+// session window, and updates the session window state of the room.
+func (whatsappClient *WhatsappCloudClient) recordCustomerMessage(
+	ctx context.Context, portal *bridgev2.Portal, timestamp time.Time,
+) {
+	log := zerolog.Ctx(ctx)
+
+	metadata, ok := portal.Metadata.(*waid.PortalMetadata)
+	if !ok || !timestamp.After(metadata.LastCustomerMessage.Time) {
+		return
+	}
+
+	metadata.LastCustomerMessage = jsontime.U(timestamp)
+	err := portal.Save(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save the last customer message of the portal")
+		return
+	}
+
+	whatsappClient.updateSessionWindowState(ctx, portal)
+}
+
+// updateSessionWindowState sends the current session window of the portal to its room.
+func (whatsappClient *WhatsappCloudClient) updateSessionWindowState(
+	ctx context.Context, portal *bridgev2.Portal,
+) {
+	if portal.MXID == "" {
+		return
+	}
+
+	metadata := portal.Metadata.(*waid.PortalMetadata)
+	expiresAt := getSessionWindowExpiry(portal)
+	content := &event.Content{
+		Parsed: &SessionWindowEventContent{
+			LastCustomerMessage: metadata.LastCustomerMessage,
+			ExpiresAt:           jsontime.U(expiresAt),
+		},
+	}
+
+	_, err := whatsappClient.Main.Bridge.Bot.SendState(
+		ctx, portal.MXID, StateSessionWindow, "", content, time.Time{},
+	)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to update the session window state")
+	}
+}
+
+// sendSessionWindowClosedNotice tells the agents that the session window of the portal is closed
+// and lists the approved templates that can be sent instead.
+func (whatsappClient *WhatsappCloudClient) sendSessionWindowClosedNotice(
+	ctx context.Context, portal *bridgev2.Portal,
+) {
+	closedAt := ""
+	if expiresAt := getSessionWindowExpiry(portal); !expiresAt.IsZero() {
+		closedAt = " at " + expiresAt.UTC().Format(time.RFC1123)
+	}
+
+	notice := fmt.Sprintf(
+		"The 24-hour customer service window of this chat closed%s, only approved templates "+
+			"can be sent until the customer writes again. "+
+			"Use `%s template send <name> <language> [params...]` to send one.",
+		closedAt, whatsappClient.Main.Bridge.Config.CommandPrefix,
+	)
+
+	templates, err := whatsappClient.GetTemplates(ctx)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to get the templates for the notice")
+	}
+
+	var approved []string
+	for _, template := range templates {
+		if template.Status == "APPROVED" {
+			approved = append(approved, fmt.Sprintf("%s (%s)", template.Name, template.Language))
+		}
+	}
+
+	if err != nil {
+		notice += "\nThe list of templates couldn't be loaded."
+	} else if len(approved) > 0 {
+		notice += "\nApproved templates: " + strings.Join(approved, ", ")
+	} else {
+		notice += "\nThere are no approved templates."
+	}
+
+	whatsappClient.sendPortalNotice(ctx, portal, notice)
+	whatsappClient.updateSessionWindowState(ctx, portal)
+}
@@ -0,0 +1,265 @@
+package cloudhandle
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultTemplatePath = "message_templates"
+	templateListLimit   = 100
+	templateListFields  = "id,name,language,category,status,rejected_reason,components"
+)
+
+// templatesURL returns the URL of the message templates of the WABA of the client.
+func (whatsappClient *WhatsappCloudClient) templatesURL(ctx context.Context) string {
+	templatePath := defaultTemplatePath
+	if configPath := whatsappClient.Main.Config.WhatsApp.CloudTemplatePath; configPath != nil {
+		if trimmedPath := strings.Trim(*configPath, "/"); trimmedPath != "" {
+			templatePath = trimmedPath
+		}
+	}
+
+	return whatsappClient.Main.GraphURL(whatsappClient.GetMetaData(ctx).WabaID, templatePath)
+}
+
+// ListTemplates gets every message template of the WABA from the Graph API.
+func (whatsappClient *WhatsappCloudClient) ListTemplates(
+	ctx context.Context,
+) ([]types.CloudTemplate, error) {
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(templateListLimit))
+	query.Set("fields", templateListFields)
+	listURL := whatsappClient.templatesURL(ctx) + "?" + query.Encode()
+
+	var templates []types.CloudTemplate
+	for listURL != "" {
+		var respData types.CloudTemplateListResponse
+		err := whatsappClient.graphRequest(ctx, http.MethodGet, listURL, "", nil, &respData)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list message templates: %w", err)
+		}
+
+		templates = append(templates, respData.Data...)
+		listURL = respData.Paging.Next
+	}
+
+	return templates, nil
+}
+
+// SyncTemplates replaces the cached templates of the WABA with the ones in the Graph API.
+func (whatsappClient *WhatsappCloudClient) SyncTemplates(
+	ctx context.Context,
+) ([]*whatsappclouddb.Template, error) {
+	cloudTemplates, err := whatsappClient.ListTemplates(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	wabaID := whatsappClient.GetMetaData(ctx).WabaID
+	templates := make([]*whatsappclouddb.Template, 0, len(cloudTemplates))
+	for _, cloudTemplate := range cloudTemplates {
+		templates = append(templates, whatsappclouddb.NewTemplate(wabaID, cloudTemplate))
+	}
+
+	err = whatsappClient.Main.DB.Template.Replace(ctx, wabaID, templates)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message templates: %w", err)
+	}
+
+	zerolog.Ctx(ctx).Info().Int("template_count", len(templates)).Msg("Message templates synced")
+	return templates, nil
+}
+
+// GetTemplates returns the cached templates of the WABA, syncing them if the cache is empty.
+func (whatsappClient *WhatsappCloudClient) GetTemplates(
+	ctx context.Context,
+) ([]*whatsappclouddb.Template, error) {
+	templates, err := whatsappClient.Main.DB.Template.GetAll(
+		ctx, whatsappClient.GetMetaData(ctx).WabaID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get message templates: %w", err)
+	}
+
+	if len(templates) == 0 {
+		return whatsappClient.SyncTemplates(ctx)
+	}
+
+	return templates, nil
+}
+
+// CreateTemplate submits a new message template for approval and caches it.
+func (whatsappClient *WhatsappCloudClient) CreateTemplate(
+	ctx context.Context, cloudTemplate types.CloudTemplate,
+) (*whatsappclouddb.Template, error) {
+	cloudTemplate.Category = strings.ToUpper(cloudTemplate.Category)
+	requestData := types.CloudTemplate{
+		Name:       cloudTemplate.Name,
+		Language:   cloudTemplate.Language,
+		Category:   cloudTemplate.Category,
+		Components: cloudTemplate.Components,
+	}
+
+	var respData types.CloudTemplateCreateResponse
+	err := whatsappClient.graphJSONRequest(
+		ctx, http.MethodPost, whatsappClient.templatesURL(ctx), requestData, &respData,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create message template: %w", err)
+	}
+
+	cloudTemplate.ID = respData.ID
+	cloudTemplate.Status = respData.Status
+	if respData.Category != "" {
+		cloudTemplate.Category = respData.Category
+	}
+
+	template := whatsappclouddb.NewTemplate(whatsappClient.GetMetaData(ctx).WabaID, cloudTemplate)
+	err = whatsappClient.Main.DB.Template.Upsert(ctx, template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save message template: %w", err)
+	}
+
+	return template, nil
+}
+
+// EditTemplate changes the category or the components of a template. Edited templates go
+// through the approval process again, so the cached template is marked as pending.
+func (whatsappClient *WhatsappCloudClient) EditTemplate(
+	ctx context.Context, templateID string, edit types.CloudTemplateEditRequest,
+) (*whatsappclouddb.Template, error) {
+	edit.Category = strings.ToUpper(edit.Category)
+
+	var respData types.CloudSuccessResponse
+	err := whatsappClient.graphJSONRequest(
+		ctx, http.MethodPost, whatsappClient.Main.GraphURL(templateID), edit, &respData,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to edit message template: %w", err)
+	}
+
+	if !respData.Success {
+		return nil, fmt.Errorf("the message template %s wasn't edited", templateID)
+	}
+
+	template, err := whatsappClient.Main.DB.Template.GetByID(
+		ctx, whatsappClient.GetMetaData(ctx).WabaID, templateID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get edited message template: %w", err)
+	}
+
+	if template == nil {
+		// The template isn't cached yet, so the whole cache is refreshed.
+		_, err = whatsappClient.SyncTemplates(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return whatsappClient.Main.DB.Template.GetByID(
+			ctx, whatsappClient.GetMetaData(ctx).WabaID, templateID,
+		)
+	}
+
+	if edit.Category != "" {
+		template.Category = edit.Category
+	}
+	if len(edit.Components) > 0 {
+		template.Components = edit.Components
+	}
+	template.Status = "PENDING"
+	template.RejectedReason = ""
+
+	err = whatsappClient.Main.DB.Template.Upsert(ctx, template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save edited message template: %w", err)
+	}
+
+	return template, nil
+}
+
+// DeleteTemplate deletes every language of a template by its name.
+func (whatsappClient *WhatsappCloudClient) DeleteTemplate(ctx context.Context, name string) error {
+	query := url.Values{}
+	query.Set("name", name)
+	deleteURL := whatsappClient.templatesURL(ctx) + "?" + query.Encode()
+
+	var respData types.CloudSuccessResponse
+	err := whatsappClient.graphRequest(ctx, http.MethodDelete, deleteURL, "", nil, &respData)
+	if err != nil {
+		return fmt.Errorf("failed to delete message template: %w", err)
+	}
+
+	if !respData.Success {
+		return fmt.Errorf("the message template %s wasn't deleted", name)
+	}
+
+	err = whatsappClient.Main.DB.Template.DeleteByName(
+		ctx, whatsappClient.GetMetaData(ctx).WabaID, name,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to delete cached message template: %w", err)
+	}
+
+	return nil
+}
+
+// HandleTemplateStatusUpdate updates the cached status of a template after Meta reviews it and
+// notifies the management room of the app.
+func (whatsappClient *WhatsappCloudClient) HandleTemplateStatusUpdate(
+	ctx context.Context, value types.CloudValue,
+) error {
+	templateID := strconv.FormatInt(value.MessageTemplateID, 10)
+	log := zerolog.Ctx(ctx).With().
+		Str("template_id", templateID).
+		Str("template_name", value.MessageTemplateName).
+		Str("template_status", value.Event).
+		Logger()
+
+	reason := value.Reason
+	if reason == "NONE" {
+		reason = ""
+	}
+
+	wabaID := whatsappClient.GetMetaData(ctx).WabaID
+	template, err := whatsappClient.Main.DB.Template.GetByID(ctx, wabaID, templateID)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get template for status update")
+		return fmt.Errorf("failed to get template %s: %w", templateID, err)
+	}
+
+	if template == nil {
+		log.Info().Msg("Template of status update isn't cached, syncing templates")
+		_, err = whatsappClient.SyncTemplates(ctx)
+	} else {
+		err = whatsappClient.Main.DB.Template.UpdateStatus(
+			ctx, wabaID, templateID, value.Event, reason,
+		)
+	}
+
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to update template status")
+		return fmt.Errorf("failed to update status of template %s: %w", templateID, err)
+	}
+
+	log.Info().Msg("Template status updated")
+
+	notice := fmt.Sprintf(
+		"The status of the template %q (%s) changed to %s",
+		value.MessageTemplateName, value.MessageTemplateLanguage, value.Event,
+	)
+	if reason != "" {
+		notice += fmt.Sprintf(", reason: %s", reason)
+	}
+	whatsappClient.sendManagementNotice(ctx, notice)
+
+	return nil
+}
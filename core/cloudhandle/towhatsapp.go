@@ -1,11 +1,11 @@
 package cloudhandle
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"slices"
 	"time"
 
 	"github.com/iKonoTelecomunicaciones/go/bridgev2"
@@ -23,21 +23,17 @@ func (whatsappClient *WhatsappCloudClient) SendMessage(
 ) (string, error) {
 	log := zerolog.Ctx(ctx).With().Str("SendMessage", string(msg.Event.ID)).Logger()
 
-	metadata := whatsappClient.GetMetaData(ctx)
+	to := string(msg.Portal.Receiver)
+	replyToID := getReplyToID(msg.ReplyTo)
 
-	headers := map[string]string{
-		"Content-Type":  "application/json",
-		"Authorization": "Bearer " + metadata.PageAccessToken,
+	interactiveMessage, err := getInteractiveMessage(msg.Event)
+	if err != nil {
+		return "", err
+	} else if interactiveMessage != nil {
+		return whatsappClient.sendCloudMessage(ctx, to, replyToID, "interactive", interactiveMessage)
 	}
 
-	sendMessageURL := fmt.Sprintf(
-		"%s/%s/%s/messages",
-		*whatsappClient.Main.Config.WhatsApp.CloudURL,
-		*whatsappClient.Main.Config.WhatsApp.CloudVersion,
-		metadata.BusinessPhoneID,
-	)
-
-	var messageData map[string]interface{}
+	var messageData any
 	var cloudMessageType string
 
 	switch messageType {
@@ -49,53 +45,93 @@ func (whatsappClient *WhatsappCloudClient) SendMessage(
 		}
 
 		// Handle text messages
+	case event.MsgLocation:
+		cloudMessageType = "location"
+
+		messageData, err = prepareLocationMessage(msg.Content)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to prepare location message")
+			return "", err
+		}
+	case event.MsgImage, event.MsgVideo, event.MsgAudio, event.MsgFile,
+		event.MessageType(event.EventSticker.Type):
+		// vCard files are sent as contacts, or as documents if they can't be parsed.
+		if isVCardFile(msg.Content) {
+			contacts, err := whatsappClient.prepareContactsMessage(ctx, msg.Content)
+			if err == nil {
+				cloudMessageType = "contacts"
+				messageData = contacts
+				break
+			}
+			log.Warn().Err(err).Msg("Failed to convert vCard into contacts, sending it as a file")
+		}
+
+		cloudMessageType = getCloudMediaType(msg.Content)
+
+		messageData, err = whatsappClient.prepareMediaMessage(ctx, msg, cloudMessageType)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to prepare media message")
+			return "", err
+		}
 	default:
 		log.Error().Msgf("Unsupported message type: %s", messageType)
 		return "", fmt.Errorf("unsupported message type: %s", messageType)
 	}
 
-	dataToSend := map[string]interface{}{
-		"messaging_product": "whatsapp",
-		"recipient_type":    "individual",
-		"to":                msg.Portal.Receiver,
-		"type":              cloudMessageType,
-		cloudMessageType:    messageData,
-	}
+	return whatsappClient.sendCloudMessage(ctx, to, replyToID, cloudMessageType, messageData)
+}
 
-	log.Debug().Interface("dataToSend", dataToSend).
-		Msgf("Sending message to WhatsApp to %s", msg.Portal.Receiver)
+// getReplyToID returns the WhatsApp ID of the message that a Matrix message replies to.
+func getReplyToID(replyTo *database.Message) string {
+	if replyTo == nil {
+		return ""
+	}
 
-	jsonData, err := json.Marshal(dataToSend)
+	parsedID, err := waid.ParseMessageID(replyTo.ID)
 	if err != nil {
-		log.Error().Err(err).Msg("Failed to marshal message data to JSON")
-		return "", err
+		return ""
 	}
+	return parsedID.ID
+}
 
-	req, err := http.NewRequest(http.MethodPost, sendMessageURL, bytes.NewReader(jsonData))
-	if err != nil {
-		log.Error().Err(err).Msg("Failed to create HTTP request")
-		return "", err
+// sendCloudMessage sends a message of the given type to a WhatsApp user and returns its ID.
+// If replyToID isn't empty, the message is sent as a reply to that message.
+func (whatsappClient *WhatsappCloudClient) sendCloudMessage(
+	ctx context.Context, to string, replyToID string, cloudMessageType string, messageData any,
+) (string, error) {
+	log := zerolog.Ctx(ctx)
+
+	metadata := whatsappClient.GetMetaData(ctx)
+	sendMessageURL := whatsappClient.Main.GraphURL(metadata.BusinessPhoneID, "messages")
+
+	dataToSend := map[string]interface{}{
+		"messaging_product": "whatsapp",
+		"recipient_type":    "individual",
+		"to":                to,
+		"type":              cloudMessageType,
+		cloudMessageType:    messageData,
 	}
 
-	for key, value := range headers {
-		req.Header.Set(key, value)
+	if replyToID != "" {
+		dataToSend["context"] = map[string]interface{}{
+			"message_id": replyToID,
+		}
 	}
 
-	resp, err := http.DefaultClient.Do(req)
+	log.Debug().Interface("dataToSend", dataToSend).
+		Msgf("Sending message to WhatsApp to %s", to)
 
+	var respData types.CloudMessageResponse
+	err := whatsappClient.graphJSONRequest(ctx, http.MethodPost, sendMessageURL, dataToSend, &respData)
 	if err != nil {
-		return "", fmt.Errorf("failed to send request: %w", err)
-	} else if resp.StatusCode >= 300 || resp.StatusCode < 200 {
-		return "", fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		return "", err
 	}
 
-	var respData types.CloudMessageResponse
-	err = json.NewDecoder(resp.Body).Decode(&respData)
-	if err != nil {
-		return "", fmt.Errorf("failed to decode response: %w, status: %d", err, resp.StatusCode)
+	if len(respData.Messages) == 0 {
+		return "", fmt.Errorf("the response doesn't contain the sent message")
 	}
 
-	log.Debug().Msgf("Message sent, status code: %d, response: %+v", resp.StatusCode, respData)
+	log.Debug().Msgf("Message sent, response: %+v", respData)
 	return respData.Messages[0].ID, nil
 }
 
@@ -118,17 +154,71 @@ func (whatsappClient *WhatsappCloudClient) handleConvertedMatrixMessage(
 		return nil, err
 	}
 
-	if msg.Content.MsgType != event.MsgText {
+	templateMessage, err := getTemplateMessage(msg.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	interactiveMessage, err := getInteractiveMessage(msg.Event)
+	if err != nil {
+		return nil, err
+	}
+
+	// Interactive messages without a body are shown in the room with their readable text.
+	showInteractiveFallback := interactiveMessage != nil && msg.Content.Body == ""
+	if showInteractiveFallback {
+		msg.Content.Body = formatInteractiveFallback(interactiveMessage)
+	}
+
+	isMedia := slices.Contains(matrixMediaTypes, msg.Content.MsgType)
+	isText := msg.Content.MsgType == event.MsgText || msg.Content.MsgType == event.MsgLocation
+	if templateMessage == nil && interactiveMessage == nil && !isText && !isMedia {
 		log.Error().Msgf("Unsupported message type: %s", msg.Content.MsgType)
 		return nil, fmt.Errorf("unsupported message type: %s", msg.Content.MsgType)
 	}
 
-	resp, err := whatsappClient.SendMessage(ctx, msg, msg.Content.MsgType)
+	// Free-form messages are rejected by Meta outside the session window, so the re-engagement
+	// template of the app is sent instead if it has one.
+	var resp, renderedText string
+	reengaged := false
+	if templateMessage != nil {
+		resp, renderedText, err = whatsappClient.SendTemplate(
+			ctx, msg.Portal, templateMessage, getReplyToID(msg.ReplyTo),
+		)
+	} else if isSessionWindowClosed(msg.Portal) {
+		log.Warn().Msg("Not sending message because the session window is closed")
+		resp, err = whatsappClient.sendReengagementTemplate(ctx, msg)
+		reengaged = true
+	} else {
+		resp, err = whatsappClient.SendMessage(ctx, msg, msg.Content.MsgType)
+		if isSessionWindowError(err) {
+			log.Warn().Err(err).Msg("Message rejected because the session window is closed")
+			resp, err = whatsappClient.sendReengagementTemplate(ctx, msg)
+			reengaged = true
+		}
+	}
 	if err != nil {
+		var graphError *types.GraphError
+		if !errors.Is(err, errSessionWindowClosed) && errors.As(err, &graphError) {
+			whatsappClient.sendErrorNotice(
+				ctx, msg.Portal, graphError.Code, graphError.Title(), graphError.Details(),
+			)
+		}
 		return nil, err
 	}
 
-	wrappedMsgID := waid.MakeMessageID(chatJID, string(msg.Event.Sender), resp)
+	// The fallback isn't shown if the re-engagement template was sent instead.
+	if showInteractiveFallback && !reengaged {
+		whatsappClient.sendPortalNotice(ctx, msg.Portal, msg.Content.Body)
+	}
+
+	// The room shows the text of the template the customer got, not the body of the event.
+	if renderedText != "" && renderedText != msg.Content.Body {
+		whatsappClient.sendPortalNotice(ctx, msg.Portal, renderedText)
+	}
+
+	// The sender of the ID is the login, so the statuses of the message can be mapped back to it.
+	wrappedMsgID := waid.MakeMessageID(chatJID, string(whatsappClient.UserLogin.ID), resp)
 	return &bridgev2.MatrixMessageResponse{
 		DB: &database.Message{
 			ID:        wrappedMsgID,
@@ -18,6 +18,12 @@ type CloudRequest struct {
 	Name            string `db:"name"`
 	AdminUser       string `db:"admin_user"`
 	PageAccessToken string `db:"page_access_token"`
+	AppSecret       string `db:"app_secret"`
+	Language        string `db:"language"`
+	VerifyToken     string `db:"verify_token"`
+
+	ReengagementTemplate string `db:"reengagement_template"`
+	ReengagementLanguage string `db:"reengagement_language"`
 }
 
 const getAppByBusinessIDQuery = `
@@ -25,10 +31,32 @@ const getAppByBusinessIDQuery = `
 	FROM wb_application
 `
 const insertAppQuery = `
-	INSERT INTO wb_application (name, admin_user, business_phone_id, waba_id, page_access_token)
-	VALUES ($1, $2, $3, $4, $5)
+	INSERT INTO wb_application (
+		name, admin_user, business_phone_id, waba_id, page_access_token, app_secret, language,
+		verify_token, reengagement_template, reengagement_language
+	)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
 	RETURNING *
 `
+const getAppsByVerifyTokenQuery = `
+	SELECT *
+	FROM wb_application
+	WHERE verify_token = $1
+`
+const updateAppReengagementTemplateQuery = `
+	UPDATE wb_application
+	SET reengagement_template = $2, reengagement_language = $3
+	WHERE waba_id = $1
+`
+const updateAppAccessTokenQuery = `
+	UPDATE wb_application
+	SET page_access_token = $2
+	WHERE waba_id = $1
+`
+const deleteAppQuery = `
+	DELETE FROM wb_application
+	WHERE waba_id = $1
+`
 
 func (cloud *CloudRequest) Scan(row dbutil.Scannable) (*CloudRequest, error) {
 	err := row.Scan(
@@ -37,6 +65,11 @@ func (cloud *CloudRequest) Scan(row dbutil.Scannable) (*CloudRequest, error) {
 		&cloud.Name,
 		&cloud.AdminUser,
 		&cloud.PageAccessToken,
+		&cloud.AppSecret,
+		&cloud.Language,
+		&cloud.VerifyToken,
+		&cloud.ReengagementTemplate,
+		&cloud.ReengagementLanguage,
 	)
 	if err != nil {
 		return nil, err
@@ -93,10 +126,50 @@ func (cloud *CloudRequestQuery) CreateApp(
 	waba_id string,
 	wb_phone_id string,
 	page_access_token string,
+	app_secret string,
+	language string,
+	verify_token string,
+	reengagement_template string,
+	reengagement_language string,
 ) (*CloudRequest, error) {
 	cloud_insert, err := cloud.QueryOne(ctx, insertAppQuery,
-		name, admin_user, wb_phone_id, waba_id, page_access_token,
+		name, admin_user, wb_phone_id, waba_id, page_access_token, app_secret, language,
+		verify_token, reengagement_template, reengagement_language,
 	)
 
 	return cloud_insert, err
 }
+
+// SearchAppsByVerifyToken returns the apps that use the given webhook verification token.
+func (cloud *CloudRequestQuery) SearchAppsByVerifyToken(
+	ctx context.Context, verifyToken string,
+) ([]*CloudRequest, error) {
+	if verifyToken == "" {
+		return nil, nil
+	}
+
+	return cloud.QueryMany(ctx, getAppsByVerifyTokenQuery, verifyToken)
+}
+
+// SetReengagementTemplate changes the template sent when the session window of a portal of the
+// app is closed. An empty name disables the fallback.
+func (cloud *CloudRequestQuery) SetReengagementTemplate(
+	ctx context.Context, wabaID string, name string, language string,
+) error {
+	_, err := cloud.GetDB().Exec(ctx, updateAppReengagementTemplateQuery, wabaID, name, language)
+	return err
+}
+
+// SetAccessToken replaces the access token used to send requests to the Graph API for the app.
+func (cloud *CloudRequestQuery) SetAccessToken(
+	ctx context.Context, wabaID string, accessToken string,
+) error {
+	_, err := cloud.GetDB().Exec(ctx, updateAppAccessTokenQuery, wabaID, accessToken)
+	return err
+}
+
+// DeleteApp deletes the app registered for the given WABA ID.
+func (cloud *CloudRequestQuery) DeleteApp(ctx context.Context, wabaID string) error {
+	_, err := cloud.GetDB().Exec(ctx, deleteAppQuery, wabaID)
+	return err
+}
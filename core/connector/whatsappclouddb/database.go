@@ -10,6 +10,10 @@ import (
 type Database struct {
 	*dbutil.Database
 	CloudRequest *CloudRequestQuery
+	WebhookEvent *WebhookEventQuery
+
+	ProcessedMessage *ProcessedMessageQuery
+	Template         *TemplateQuery
 }
 
 func New(bridgeID networkid.BridgeID, db *dbutil.Database, log zerolog.Logger) *Database {
@@ -21,5 +25,20 @@ func New(bridgeID networkid.BridgeID, db *dbutil.Database, log zerolog.Logger) *
 				return &CloudRequest{}
 			}),
 		},
+		WebhookEvent: &WebhookEventQuery{
+			QueryHelper: dbutil.MakeQueryHelper(db, func(_ *dbutil.QueryHelper[*WebhookEvent]) *WebhookEvent {
+				return &WebhookEvent{}
+			}),
+		},
+		ProcessedMessage: &ProcessedMessageQuery{
+			QueryHelper: dbutil.MakeQueryHelper(db, func(_ *dbutil.QueryHelper[*ProcessedMessage]) *ProcessedMessage {
+				return &ProcessedMessage{}
+			}),
+		},
+		Template: &TemplateQuery{
+			QueryHelper: dbutil.MakeQueryHelper(db, func(_ *dbutil.QueryHelper[*Template]) *Template {
+				return &Template{}
+			}),
+		},
 	}
 }
@@ -0,0 +1,85 @@
+package whatsappclouddb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+type ProcessedMessageQuery struct {
+	*dbutil.QueryHelper[*ProcessedMessage]
+}
+
+// ProcessedMessage is a message ID of WhatsApp Cloud that was already processed. The kind allows
+// the same ID to be processed once for each event it's used in, like the statuses of a message.
+type ProcessedMessage struct {
+	WabaID    string    `db:"waba_id"`
+	MessageID string    `db:"message_id"`
+	Kind      string    `db:"kind"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+const (
+	insertProcessedMessageQuery = `
+		INSERT INTO wb_processed_message (waba_id, message_id, kind, created_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT DO NOTHING
+	`
+	deleteProcessedMessageQuery = `
+		DELETE FROM wb_processed_message WHERE waba_id = $1 AND message_id = $2 AND kind = $3
+	`
+	deleteProcessedMessagesByWabaQuery = `
+		DELETE FROM wb_processed_message WHERE waba_id = $1
+	`
+	deleteOldProcessedMessagesQuery = `
+		DELETE FROM wb_processed_message WHERE created_at < $1
+	`
+)
+
+func (processed *ProcessedMessage) Scan(row dbutil.Scannable) (*ProcessedMessage, error) {
+	var createdAt int64
+	err := row.Scan(&processed.WabaID, &processed.MessageID, &processed.Kind, &createdAt)
+	if err != nil {
+		return nil, err
+	}
+	processed.CreatedAt = time.UnixMilli(createdAt)
+	return processed, nil
+}
+
+// Claim marks a message ID as processed. It returns false if the ID was already processed.
+func (query *ProcessedMessageQuery) Claim(
+	ctx context.Context, wabaID string, messageID string, kind string,
+) (bool, error) {
+	res, err := query.GetDB().Exec(
+		ctx, insertProcessedMessageQuery, wabaID, messageID, kind, time.Now().UnixMilli(),
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim processed message %s: %w", messageID, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get affected rows: %w", err)
+	}
+
+	return affected > 0, nil
+}
+
+// Release removes a claimed message ID, so it can be processed again if Meta sends it again.
+func (query *ProcessedMessageQuery) Release(
+	ctx context.Context, wabaID string, messageID string, kind string,
+) error {
+	return query.Exec(ctx, deleteProcessedMessageQuery, wabaID, messageID, kind)
+}
+
+// DeleteOlderThan removes the message IDs processed before the given time.
+func (query *ProcessedMessageQuery) DeleteOlderThan(ctx context.Context, before time.Time) error {
+	return query.Exec(ctx, deleteOldProcessedMessagesQuery, before.UnixMilli())
+}
+
+// DeleteAll deletes all the processed IDs of a WABA.
+func (query *ProcessedMessageQuery) DeleteAll(ctx context.Context, wabaID string) error {
+	return query.Exec(ctx, deleteProcessedMessagesByWabaQuery, wabaID)
+}
@@ -0,0 +1,196 @@
+package whatsappclouddb
+
+import (
+	"context"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"go.mau.fi/util/dbutil"
+)
+
+type TemplateQuery struct {
+	*dbutil.QueryHelper[*Template]
+}
+
+// Template is a message template of a WABA cached from the Graph API.
+type Template struct {
+	WabaID         string                         `db:"waba_id" json:"waba_id"`
+	TemplateID     string                         `db:"template_id" json:"id"`
+	Name           string                         `db:"name" json:"name"`
+	Language       string                         `db:"language" json:"language"`
+	Category       string                         `db:"category" json:"category"`
+	Status         string                         `db:"status" json:"status"`
+	RejectedReason string                         `db:"rejected_reason" json:"rejected_reason,omitempty"`
+	Components     []types.CloudTemplateComponent `db:"components" json:"components"`
+	UpdatedAt      time.Time                      `db:"updated_at" json:"updated_at"`
+}
+
+const (
+	getTemplatesBaseQuery = `
+		SELECT waba_id, template_id, name, language, category, status, rejected_reason, components,
+			updated_at
+		FROM wb_template
+	`
+	getTemplatesByWabaQuery = getTemplatesBaseQuery + `
+		WHERE waba_id = $1 ORDER BY name, language
+	`
+	getTemplatesByNameQuery = getTemplatesBaseQuery + `
+		WHERE waba_id = $1 AND name = $2 ORDER BY language
+	`
+	getTemplateByNameAndLangQuery = getTemplatesBaseQuery + `
+		WHERE waba_id = $1 AND name = $2 AND language = $3
+	`
+	getTemplateByIDQuery = getTemplatesBaseQuery + `
+		WHERE waba_id = $1 AND template_id = $2
+	`
+	upsertTemplateQuery = `
+		INSERT INTO wb_template (
+			waba_id, template_id, name, language, category, status, rejected_reason, components,
+			updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		ON CONFLICT (waba_id, name, language) DO UPDATE
+			SET template_id=excluded.template_id, category=excluded.category,
+				status=excluded.status, rejected_reason=excluded.rejected_reason,
+				components=excluded.components, updated_at=excluded.updated_at
+	`
+	updateTemplateStatusQuery = `
+		UPDATE wb_template
+		SET status = $3, rejected_reason = $4, updated_at = $5
+		WHERE waba_id = $1 AND template_id = $2
+	`
+	deleteTemplatesByNameQuery = `
+		DELETE FROM wb_template WHERE waba_id = $1 AND name = $2
+	`
+	deleteTemplatesByWabaQuery = `
+		DELETE FROM wb_template WHERE waba_id = $1
+	`
+)
+
+func (template *Template) Scan(row dbutil.Scannable) (*Template, error) {
+	var updatedAt int64
+	err := row.Scan(
+		&template.WabaID,
+		&template.TemplateID,
+		&template.Name,
+		&template.Language,
+		&template.Category,
+		&template.Status,
+		&template.RejectedReason,
+		dbutil.JSON{Data: &template.Components},
+		&updatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	template.UpdatedAt = time.UnixMilli(updatedAt)
+	return template, nil
+}
+
+func (template *Template) sqlVariables() []any {
+	return []any{
+		template.WabaID,
+		template.TemplateID,
+		template.Name,
+		template.Language,
+		template.Category,
+		template.Status,
+		template.RejectedReason,
+		dbutil.JSON{Data: template.Components},
+		template.UpdatedAt.UnixMilli(),
+	}
+}
+
+// NewTemplate converts a template returned by the Graph API to its cached version.
+func NewTemplate(wabaID string, cloudTemplate types.CloudTemplate) *Template {
+	return &Template{
+		WabaID:         wabaID,
+		TemplateID:     cloudTemplate.ID,
+		Name:           cloudTemplate.Name,
+		Language:       cloudTemplate.Language,
+		Category:       cloudTemplate.Category,
+		Status:         cloudTemplate.Status,
+		RejectedReason: cloudTemplate.RejectedReason,
+		Components:     cloudTemplate.Components,
+		UpdatedAt:      time.Now(),
+	}
+}
+
+// ToCloudTemplate converts the cached template to the format used by the Graph API.
+func (template *Template) ToCloudTemplate() types.CloudTemplate {
+	return types.CloudTemplate{
+		ID:             template.TemplateID,
+		Name:           template.Name,
+		Language:       template.Language,
+		Category:       template.Category,
+		Status:         template.Status,
+		RejectedReason: template.RejectedReason,
+		Components:     template.Components,
+	}
+}
+
+func (query *TemplateQuery) GetAll(ctx context.Context, wabaID string) ([]*Template, error) {
+	return query.QueryMany(ctx, getTemplatesByWabaQuery, wabaID)
+}
+
+func (query *TemplateQuery) GetByName(
+	ctx context.Context, wabaID string, name string,
+) ([]*Template, error) {
+	return query.QueryMany(ctx, getTemplatesByNameQuery, wabaID, name)
+}
+
+func (query *TemplateQuery) GetByNameAndLanguage(
+	ctx context.Context, wabaID string, name string, language string,
+) (*Template, error) {
+	return query.QueryOne(ctx, getTemplateByNameAndLangQuery, wabaID, name, language)
+}
+
+func (query *TemplateQuery) GetByID(
+	ctx context.Context, wabaID string, templateID string,
+) (*Template, error) {
+	return query.QueryOne(ctx, getTemplateByIDQuery, wabaID, templateID)
+}
+
+func (query *TemplateQuery) Upsert(ctx context.Context, template *Template) error {
+	return query.Exec(ctx, upsertTemplateQuery, template.sqlVariables()...)
+}
+
+// UpdateStatus changes the approval status of a cached template.
+func (query *TemplateQuery) UpdateStatus(
+	ctx context.Context, wabaID string, templateID string, status string, reason string,
+) error {
+	return query.Exec(
+		ctx, updateTemplateStatusQuery, wabaID, templateID, status, reason, time.Now().UnixMilli(),
+	)
+}
+
+// DeleteByName deletes every language of a template.
+func (query *TemplateQuery) DeleteByName(ctx context.Context, wabaID string, name string) error {
+	return query.Exec(ctx, deleteTemplatesByNameQuery, wabaID, name)
+}
+
+// DeleteAll deletes all the cached templates of a WABA.
+func (query *TemplateQuery) DeleteAll(ctx context.Context, wabaID string) error {
+	return query.Exec(ctx, deleteTemplatesByWabaQuery, wabaID)
+}
+
+// Replace replaces all the cached templates of a WABA with the given ones.
+func (query *TemplateQuery) Replace(
+	ctx context.Context, wabaID string, templates []*Template,
+) error {
+	return query.GetDB().DoTxn(ctx, nil, func(ctx context.Context) error {
+		err := query.Exec(ctx, deleteTemplatesByWabaQuery, wabaID)
+		if err != nil {
+			return err
+		}
+
+		for _, template := range templates {
+			err = query.Upsert(ctx, template)
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
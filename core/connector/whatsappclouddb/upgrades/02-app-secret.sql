@@ -0,0 +1,2 @@
+-- v1 -> v2: Add the app secret used to verify the signature of incoming webhooks
+ALTER TABLE wb_application ADD COLUMN app_secret TEXT NOT NULL DEFAULT '';
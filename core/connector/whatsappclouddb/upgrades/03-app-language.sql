@@ -0,0 +1,2 @@
+-- v2 -> v3: Add the language used for the notices of the app
+ALTER TABLE wb_application ADD COLUMN language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,19 @@
+-- v3 -> v4: Add the queue of the webhooks received from WhatsApp Cloud
+CREATE TABLE wb_webhook_event (
+	-- only: sqlite (line commented)
+--	id              INTEGER PRIMARY KEY,
+	-- only: postgres
+	id              BIGINT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+
+	waba_id         TEXT    NOT NULL,
+	ordering_key    TEXT    NOT NULL,
+	payload         TEXT    NOT NULL,
+	status          TEXT    NOT NULL,
+	attempts        INTEGER NOT NULL DEFAULT 0,
+	next_attempt_at BIGINT  NOT NULL,
+	last_error      TEXT    NOT NULL DEFAULT '',
+	created_at      BIGINT  NOT NULL
+);
+
+CREATE INDEX wb_webhook_event_status_idx ON wb_webhook_event (status, next_attempt_at);
+CREATE INDEX wb_webhook_event_ordering_key_idx ON wb_webhook_event (ordering_key, id);
@@ -0,0 +1,11 @@
+-- v4 -> v5: Add the processed message IDs to ignore the webhooks sent again by Meta
+CREATE TABLE wb_processed_message (
+	waba_id    TEXT   NOT NULL,
+	message_id TEXT   NOT NULL,
+	kind       TEXT   NOT NULL,
+	created_at BIGINT NOT NULL,
+
+	PRIMARY KEY (waba_id, message_id, kind)
+);
+
+CREATE INDEX wb_processed_message_created_at_idx ON wb_processed_message (created_at);
@@ -0,0 +1,2 @@
+-- v5 -> v6: Add the webhook verification token of the apps
+ALTER TABLE wb_application ADD COLUMN verify_token TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,16 @@
+-- v6 -> v7: Add the cache of the message templates of the apps
+CREATE TABLE wb_template (
+	waba_id         TEXT   NOT NULL,
+	template_id     TEXT   NOT NULL,
+	name            TEXT   NOT NULL,
+	language        TEXT   NOT NULL,
+	category        TEXT   NOT NULL,
+	status          TEXT   NOT NULL,
+	rejected_reason TEXT   NOT NULL DEFAULT '',
+	components      TEXT   NOT NULL,
+	updated_at      BIGINT NOT NULL,
+
+	PRIMARY KEY (waba_id, name, language)
+);
+
+CREATE INDEX wb_template_template_id_idx ON wb_template (waba_id, template_id);
@@ -0,0 +1,3 @@
+-- v7 -> v8: Add the re-engagement template sent when the session window of a portal is closed
+ALTER TABLE wb_application ADD COLUMN reengagement_template TEXT NOT NULL DEFAULT '';
+ALTER TABLE wb_application ADD COLUMN reengagement_language TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,195 @@
+package whatsappclouddb
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mau.fi/util/dbutil"
+)
+
+type WebhookEventStatus string
+
+const (
+	WebhookEventPending    WebhookEventStatus = "pending"
+	WebhookEventProcessing WebhookEventStatus = "processing"
+	WebhookEventDead       WebhookEventStatus = "dead"
+)
+
+type WebhookEventQuery struct {
+	*dbutil.QueryHelper[*WebhookEvent]
+}
+
+// WebhookEvent is a part of a webhook received from WhatsApp Cloud that is waiting to be
+// processed. The events with the same ordering key are processed one at a time, in order.
+type WebhookEvent struct {
+	ID            int64              `db:"id"`
+	WabaID        string             `db:"waba_id"`
+	OrderingKey   string             `db:"ordering_key"`
+	Payload       string             `db:"payload"`
+	Status        WebhookEventStatus `db:"status"`
+	Attempts      int                `db:"attempts"`
+	NextAttemptAt time.Time          `db:"next_attempt_at"`
+	LastError     string             `db:"last_error"`
+	CreatedAt     time.Time          `db:"created_at"`
+}
+
+const (
+	insertWebhookEventQuery = `
+		INSERT INTO wb_webhook_event (
+			waba_id, ordering_key, payload, status, attempts, next_attempt_at, last_error, created_at
+		)
+		VALUES ($1, $2, $3, $4, 0, $5, '', $6)
+	`
+	// An event can only be claimed if there are no previous events with the same ordering key
+	// that are still pending or being processed. Dead events don't block the next ones.
+	getClaimableWebhookEventsQuery = `
+		SELECT id, waba_id, ordering_key, payload, status, attempts, next_attempt_at, last_error,
+			created_at
+		FROM wb_webhook_event queued
+		WHERE status = 'pending' AND next_attempt_at <= $1 AND NOT EXISTS (
+			SELECT 1 FROM wb_webhook_event previous
+			WHERE previous.ordering_key = queued.ordering_key
+				AND previous.id < queued.id
+				AND previous.status <> 'dead'
+		)
+		ORDER BY id
+		LIMIT $2
+	`
+	claimWebhookEventQuery = `
+		UPDATE wb_webhook_event
+		SET status = 'processing', next_attempt_at = $2
+		WHERE id = $1 AND status = 'pending'
+	`
+	extendWebhookEventLockQuery = `
+		UPDATE wb_webhook_event
+		SET next_attempt_at = $2
+		WHERE id = $1 AND status = 'processing'
+	`
+	deleteWebhookEventQuery = `
+		DELETE FROM wb_webhook_event WHERE id = $1
+	`
+	deleteWebhookEventsByWabaQuery = `
+		DELETE FROM wb_webhook_event WHERE waba_id = $1
+	`
+	failWebhookEventQuery = `
+		UPDATE wb_webhook_event
+		SET status = $2, attempts = $3, next_attempt_at = $4, last_error = $5, payload = $6
+		WHERE id = $1
+	`
+	// Events stay in the processing state until their lock expires, so the events of a bridge
+	// that stopped while processing them are retried.
+	releaseStaleWebhookEventsQuery = `
+		UPDATE wb_webhook_event
+		SET status = 'pending'
+		WHERE status = 'processing' AND next_attempt_at <= $1
+	`
+)
+
+func (evt *WebhookEvent) Scan(row dbutil.Scannable) (*WebhookEvent, error) {
+	var nextAttemptAt, createdAt int64
+	err := row.Scan(
+		&evt.ID,
+		&evt.WabaID,
+		&evt.OrderingKey,
+		&evt.Payload,
+		&evt.Status,
+		&evt.Attempts,
+		&nextAttemptAt,
+		&evt.LastError,
+		&createdAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	evt.NextAttemptAt = time.UnixMilli(nextAttemptAt)
+	evt.CreatedAt = time.UnixMilli(createdAt)
+	return evt, nil
+}
+
+// Insert adds a new pending event to the queue.
+func (query *WebhookEventQuery) Insert(
+	ctx context.Context, wabaID string, orderingKey string, payload string,
+) error {
+	now := time.Now().UnixMilli()
+	return query.Exec(
+		ctx, insertWebhookEventQuery, wabaID, orderingKey, payload, WebhookEventPending, now, now,
+	)
+}
+
+// Claim marks up to limit events as being processed and returns them. The events are locked
+// until lockUntil, after that they are released to be processed again.
+func (query *WebhookEventQuery) Claim(
+	ctx context.Context, limit int, lockUntil time.Time,
+) ([]*WebhookEvent, error) {
+	candidates, err := query.QueryMany(
+		ctx, getClaimableWebhookEventsQuery, time.Now().UnixMilli(), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get claimable webhook events: %w", err)
+	}
+
+	claimed := make([]*WebhookEvent, 0, len(candidates))
+	for _, evt := range candidates {
+		// Another replica may have claimed the event after it was selected.
+		res, err := query.GetDB().Exec(ctx, claimWebhookEventQuery, evt.ID, lockUntil.UnixMilli())
+		if err != nil {
+			return claimed, fmt.Errorf("failed to claim webhook event %d: %w", evt.ID, err)
+		}
+
+		if affected, err := res.RowsAffected(); err != nil || affected != 1 {
+			continue
+		}
+
+		evt.Status = WebhookEventProcessing
+		evt.NextAttemptAt = lockUntil
+		claimed = append(claimed, evt)
+	}
+
+	return claimed, nil
+}
+
+// ExtendLock keeps an event that is still being processed locked until lockUntil, so it isn't
+// released and claimed again while it's in flight.
+func (query *WebhookEventQuery) ExtendLock(
+	ctx context.Context, id int64, lockUntil time.Time,
+) error {
+	return query.Exec(ctx, extendWebhookEventLockQuery, id, lockUntil.UnixMilli())
+}
+
+// Delete removes an event that was processed successfully.
+func (query *WebhookEventQuery) Delete(ctx context.Context, id int64) error {
+	return query.Exec(ctx, deleteWebhookEventQuery, id)
+}
+
+// DeleteAll removes all the events of a WABA, including the dead ones.
+func (query *WebhookEventQuery) DeleteAll(ctx context.Context, wabaID string) error {
+	return query.Exec(ctx, deleteWebhookEventsByWabaQuery, wabaID)
+}
+
+// Retry records a failed attempt and schedules the event to be processed again. The payload of
+// the event is replaced, so only the part that failed is retried.
+func (query *WebhookEventQuery) Retry(
+	ctx context.Context, evt *WebhookEvent, nextAttemptAt time.Time, lastError string,
+) error {
+	return query.Exec(
+		ctx, failWebhookEventQuery,
+		evt.ID, WebhookEventPending, evt.Attempts, nextAttemptAt.UnixMilli(), lastError,
+		evt.Payload,
+	)
+}
+
+// MarkDead records the last failed attempt and stops retrying the event.
+func (query *WebhookEventQuery) MarkDead(
+	ctx context.Context, evt *WebhookEvent, lastError string,
+) error {
+	return query.Exec(
+		ctx, failWebhookEventQuery,
+		evt.ID, WebhookEventDead, evt.Attempts, time.Now().UnixMilli(), lastError, evt.Payload,
+	)
+}
+
+// ReleaseStale returns the events whose processing lock expired to the pending state.
+func (query *WebhookEventQuery) ReleaseStale(ctx context.Context) error {
+	return query.Exec(ctx, releaseStaleWebhookEventsQuery, time.Now().UnixMilli())
+}
@@ -12,11 +12,102 @@ type CloudContact struct {
 	WaID string `json:"wa_id"`
 }
 
-type ImageCloud struct {
+type CloudMedia struct {
 	ID       string  `json:"id"`
 	MimeType string  `json:"mime_type"`
 	SHA256   string  `json:"sha256"`
 	Caption  *string `json:"caption"`
+	Filename string  `json:"filename"`
+	Voice    bool    `json:"voice"`
+	Animated bool    `json:"animated"`
+}
+
+type CloudReaction struct {
+	MessageID string `json:"message_id"`
+	Emoji     string `json:"emoji"`
+}
+
+type CloudLocation struct {
+	Latitude  float64 `json:"latitude"`
+	Longitude float64 `json:"longitude"`
+	Name      string  `json:"name,omitempty"`
+	Address   string  `json:"address,omitempty"`
+	URL       string  `json:"url,omitempty"`
+}
+
+type CloudContactName struct {
+	FormattedName string `json:"formatted_name"`
+	FirstName     string `json:"first_name,omitempty"`
+	LastName      string `json:"last_name,omitempty"`
+	MiddleName    string `json:"middle_name,omitempty"`
+	Prefix        string `json:"prefix,omitempty"`
+	Suffix        string `json:"suffix,omitempty"`
+}
+
+type CloudContactPhone struct {
+	Phone string `json:"phone"`
+	Type  string `json:"type,omitempty"`
+	WaID  string `json:"wa_id,omitempty"`
+}
+
+type CloudContactEmail struct {
+	Email string `json:"email"`
+	Type  string `json:"type,omitempty"`
+}
+
+type CloudContactOrg struct {
+	Company    string `json:"company,omitempty"`
+	Department string `json:"department,omitempty"`
+	Title      string `json:"title,omitempty"`
+}
+
+type CloudContactAddress struct {
+	Street      string `json:"street,omitempty"`
+	City        string `json:"city,omitempty"`
+	State       string `json:"state,omitempty"`
+	Zip         string `json:"zip,omitempty"`
+	Country     string `json:"country,omitempty"`
+	CountryCode string `json:"country_code,omitempty"`
+	Type        string `json:"type,omitempty"`
+}
+
+type CloudContactURL struct {
+	URL  string `json:"url"`
+	Type string `json:"type,omitempty"`
+}
+
+// CloudContactCard is a contact shared in a contacts message.
+type CloudContactCard struct {
+	Name      CloudContactName      `json:"name"`
+	Phones    []CloudContactPhone   `json:"phones,omitempty"`
+	Emails    []CloudContactEmail   `json:"emails,omitempty"`
+	Org       *CloudContactOrg      `json:"org,omitempty"`
+	Addresses []CloudContactAddress `json:"addresses,omitempty"`
+	URLs      []CloudContactURL     `json:"urls,omitempty"`
+	Birthday  string                `json:"birthday,omitempty"`
+}
+
+// CloudReferral is the ad or post that the customer clicked to start a conversation.
+type CloudReferral struct {
+	SourceURL    string `json:"source_url"`
+	SourceID     string `json:"source_id"`
+	SourceType   string `json:"source_type"`
+	Headline     string `json:"headline,omitempty"`
+	Body         string `json:"body,omitempty"`
+	MediaType    string `json:"media_type,omitempty"`
+	ImageURL     string `json:"image_url,omitempty"`
+	VideoURL     string `json:"video_url,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	CtwaClid     string `json:"ctwa_clid,omitempty"`
+}
+
+// CloudMessageContext is the context of a message that replies to another one or was forwarded.
+type CloudMessageContext struct {
+	From                string `json:"from"`
+	To                  string `json:"to"`
+	ID                  string `json:"id"`
+	Forwarded           bool   `json:"forwarded"`
+	FrequentlyForwarded bool   `json:"frequently_forwarded"`
 }
 
 type CloudMessage struct {
@@ -26,15 +117,41 @@ type CloudMessage struct {
 	Text *struct {
 		Body string `json:"body"`
 	} `json:"text"`
-	Image     *ImageCloud `json:"image"`
-	TimeStamp string      `json:"timestamp"`
-	Context   *struct {
-		From string `json:"from"`
-		To   string `json:"to"`
-	} `json:"context"`
+	Image       *CloudMedia               `json:"image"`
+	Video       *CloudMedia               `json:"video"`
+	Audio       *CloudMedia               `json:"audio"`
+	Document    *CloudMedia               `json:"document"`
+	Sticker     *CloudMedia               `json:"sticker"`
+	Reaction    *CloudReaction            `json:"reaction"`
+	Location    *CloudLocation            `json:"location"`
+	Contacts    []CloudContactCard        `json:"contacts"`
+	Interactive *CloudInteractiveResponse `json:"interactive"`
+	Button      *CloudButtonResponse      `json:"button"`
+	Referral    *CloudReferral            `json:"referral"`
+	TimeStamp   string                    `json:"timestamp"`
+	Context     *CloudMessageContext      `json:"context"`
+}
+
+// GetMedia returns the media object that matches the type of the message,
+// or nil if the message doesn't contain media.
+func (message *CloudMessage) GetMedia() *CloudMedia {
+	switch message.Type {
+	case "image":
+		return message.Image
+	case "video":
+		return message.Video
+	case "audio":
+		return message.Audio
+	case "document":
+		return message.Document
+	case "sticker":
+		return message.Sticker
+	default:
+		return nil
+	}
 }
 
-type CloudErrors []struct {
+type CloudError struct {
 	Code      int    `json:"code"`
 	Title     string `json:"title"`
 	Message   string `json:"message"`
@@ -43,7 +160,9 @@ type CloudErrors []struct {
 	} `json:"error_data"`
 }
 
-type CloudStatuses []struct {
+type CloudErrors []CloudError
+
+type CloudStatus struct {
 	ID          string      `json:"id"`
 	Status      string      `json:"status"`
 	Timestamp   string      `json:"timestamp"`
@@ -51,23 +170,36 @@ type CloudStatuses []struct {
 	Errors      CloudErrors `json:"errors"`
 }
 
+type CloudStatuses []CloudStatus
+
 type CloudValue struct {
 	MessagingProduct string         `json:"messaging_product"`
 	Metadata         CloudMetaData  `json:"metadata"`
 	Contacts         []CloudContact `json:"contacts"`
 	Messages         []CloudMessage `json:"messages"`
 	Statuses         *CloudStatuses `json:"statuses"`
+
+	// Fields of the message_template_status_update changes.
+	Event                   string `json:"event,omitempty"`
+	MessageTemplateID       int64  `json:"message_template_id,omitempty"`
+	MessageTemplateName     string `json:"message_template_name,omitempty"`
+	MessageTemplateLanguage string `json:"message_template_language,omitempty"`
+	Reason                  string `json:"reason,omitempty"`
+}
+
+type CloudChange struct {
+	Value CloudValue `json:"value"`
+	Field string     `json:"field"`
+}
+
+type CloudEntry struct {
+	ID      string        `json:"id"`
+	Changes []CloudChange `json:"changes"`
 }
 
 type CloudEvent struct {
-	Object string `json:"object"`
-	Entry  []struct {
-		ID      string `json:"id"`
-		Changes []struct {
-			Value CloudValue `json:"value"`
-			Field string     `json:"field"`
-		} `json:"changes"`
-	} `json:"entry"`
+	Object string       `json:"object"`
+	Entry  []CloudEntry `json:"entry"`
 }
 
 type CloudRegisterAppRequest struct {
@@ -75,8 +207,20 @@ type CloudRegisterAppRequest struct {
 	WabaID      string  `json:"waba_id"`
 	AppPhoneID  string  `json:"app_phone_id"`
 	AccessToken string  `json:"access_token"`
+	AppSecret   string  `json:"app_secret"`
+	VerifyToken string  `json:"verify_token"`
+	Language    string  `json:"language"`
 	NoticeRoom  string  `json:"notice_room"`
 	AdminUser   *string `json:"admin_user"`
+
+	ReengagementTemplate string `json:"reengagement_template"`
+	ReengagementLanguage string `json:"reengagement_language"`
+}
+
+// CloudUpdateTokenRequest is the body of the provisioning request that replaces the access token
+// of an app.
+type CloudUpdateTokenRequest struct {
+	AccessToken string `json:"access_token"`
 }
 
 type CloudUserMetadata struct {
@@ -120,3 +264,7 @@ type MediaResponse struct {
 	FileInfo *FileInfo
 	Caption  *string
 }
+
+type CloudMediaUploadResponse struct {
+	ID string `json:"id"`
+}
@@ -0,0 +1,58 @@
+package types
+
+import "fmt"
+
+type GraphError struct {
+	Message        string `json:"message"`
+	Type           string `json:"type"`
+	Code           int    `json:"code"`
+	ErrorSubcode   int    `json:"error_subcode"`
+	ErrorUserTitle string `json:"error_user_title"`
+	ErrorUserMsg   string `json:"error_user_msg"`
+	ErrorData      struct {
+		MessagingProduct string `json:"messaging_product"`
+		Details          string `json:"details"`
+	} `json:"error_data"`
+	FBTraceID  string `json:"fbtrace_id"`
+	StatusCode int    `json:"-"`
+}
+
+type GraphErrorResponse struct {
+	Error *GraphError `json:"error"`
+}
+
+// Error returns a readable description of the error returned by the Graph API.
+func (graphError *GraphError) Error() string {
+	return fmt.Sprintf(
+		"graph api error %d (%s, status %d): %s",
+		graphError.Code, graphError.Type, graphError.StatusCode, graphError.Message,
+	)
+}
+
+// Title returns the short description of the error, preferring the one meant for users.
+func (graphError *GraphError) Title() string {
+	if graphError.ErrorUserTitle != "" {
+		return graphError.ErrorUserTitle
+	}
+	return graphError.Type
+}
+
+// Details returns the long description of the error, preferring the one meant for users.
+func (graphError *GraphError) Details() string {
+	if graphError.ErrorUserMsg != "" {
+		return graphError.ErrorUserMsg
+	}
+	if graphError.ErrorData.Details != "" {
+		return graphError.ErrorData.Details
+	}
+	return graphError.Message
+}
+
+// CloudPhoneNumber is the business phone number of an app, as returned by the Graph API.
+type CloudPhoneNumber struct {
+	ID                 string `json:"id"`
+	DisplayPhoneNumber string `json:"display_phone_number"`
+	VerifiedName       string `json:"verified_name"`
+	QualityRating      string `json:"quality_rating"`
+	MessagingLimitTier string `json:"messaging_limit_tier"`
+}
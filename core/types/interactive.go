@@ -0,0 +1,76 @@
+package types
+
+type CloudInteractiveText struct {
+	Text string `json:"text"`
+}
+
+type CloudInteractiveHeader struct {
+	Type string `json:"type"`
+	Text string `json:"text,omitempty"`
+}
+
+type CloudInteractiveReply struct {
+	ID    string `json:"id"`
+	Title string `json:"title"`
+}
+
+type CloudInteractiveButton struct {
+	Type  string                `json:"type"`
+	Reply CloudInteractiveReply `json:"reply"`
+}
+
+type CloudInteractiveRow struct {
+	ID          string `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+}
+
+type CloudInteractiveSection struct {
+	Title string                `json:"title,omitempty"`
+	Rows  []CloudInteractiveRow `json:"rows"`
+}
+
+type CloudInteractiveParameters struct {
+	DisplayText string `json:"display_text,omitempty"`
+	URL         string `json:"url,omitempty"`
+}
+
+type CloudInteractiveAction struct {
+	Name       string                      `json:"name,omitempty"`
+	Button     string                      `json:"button,omitempty"`
+	Buttons    []CloudInteractiveButton    `json:"buttons,omitempty"`
+	Sections   []CloudInteractiveSection   `json:"sections,omitempty"`
+	Parameters *CloudInteractiveParameters `json:"parameters,omitempty"`
+}
+
+// CloudInteractive is the interactive object of a button, list, call-to-action URL or location
+// request message.
+type CloudInteractive struct {
+	Type   string                  `json:"type"`
+	Header *CloudInteractiveHeader `json:"header,omitempty"`
+	Body   *CloudInteractiveText   `json:"body,omitempty"`
+	Footer *CloudInteractiveText   `json:"footer,omitempty"`
+	Action *CloudInteractiveAction `json:"action,omitempty"`
+}
+
+// CloudFlowResponse is the answer of a WhatsApp Flow. The answers of the form are sent as a JSON
+// string in ResponseJSON.
+type CloudFlowResponse struct {
+	Name         string `json:"name"`
+	Body         string `json:"body"`
+	ResponseJSON string `json:"response_json"`
+}
+
+// CloudInteractiveResponse is the answer of a customer to an interactive message.
+type CloudInteractiveResponse struct {
+	Type        string                 `json:"type"`
+	ButtonReply *CloudInteractiveReply `json:"button_reply"`
+	ListReply   *CloudInteractiveRow   `json:"list_reply"`
+	NfmReply    *CloudFlowResponse     `json:"nfm_reply"`
+}
+
+// CloudButtonResponse is the answer of a customer to a quick reply button of a template.
+type CloudButtonResponse struct {
+	Payload string `json:"payload"`
+	Text    string `json:"text"`
+}
@@ -0,0 +1,59 @@
+package types
+
+import "encoding/json"
+
+type CloudTemplateButton struct {
+	Type        string          `json:"type"`
+	Text        string          `json:"text,omitempty"`
+	URL         string          `json:"url,omitempty"`
+	PhoneNumber string          `json:"phone_number,omitempty"`
+	Example     json.RawMessage `json:"example,omitempty"`
+}
+
+type CloudTemplateComponent struct {
+	Type    string                `json:"type"`
+	Format  string                `json:"format,omitempty"`
+	Text    string                `json:"text,omitempty"`
+	Buttons []CloudTemplateButton `json:"buttons,omitempty"`
+	Example json.RawMessage       `json:"example,omitempty"`
+}
+
+type CloudTemplate struct {
+	ID             string                   `json:"id,omitempty"`
+	Name           string                   `json:"name"`
+	Language       string                   `json:"language"`
+	Category       string                   `json:"category"`
+	Status         string                   `json:"status,omitempty"`
+	RejectedReason string                   `json:"rejected_reason,omitempty"`
+	Components     []CloudTemplateComponent `json:"components"`
+}
+
+type CloudTemplateListResponse struct {
+	Data   []CloudTemplate `json:"data"`
+	Paging struct {
+		Next string `json:"next"`
+	} `json:"paging"`
+}
+
+type CloudTemplateCreateResponse struct {
+	ID       string `json:"id"`
+	Status   string `json:"status"`
+	Category string `json:"category"`
+}
+
+type CloudTemplateEditRequest struct {
+	Category   string                   `json:"category,omitempty"`
+	Components []CloudTemplateComponent `json:"components,omitempty"`
+}
+
+type CloudSuccessResponse struct {
+	Success bool `json:"success"`
+}
+
+// CloudTemplateMessage is the template of the com.ikono.whatsapp.template field of Matrix events.
+// The parameters fill the header, body and buttons of the template in that order.
+type CloudTemplateMessage struct {
+	Name       string   `json:"name"`
+	Language   string   `json:"language"`
+	Parameters []string `json:"parameters,omitempty"`
+}
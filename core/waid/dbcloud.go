@@ -19,6 +19,7 @@ package waid
 import (
 	"encoding/json"
 
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
 	"go.mau.fi/util/jsontime"
 )
 
@@ -80,6 +81,21 @@ type PortalMetadata struct {
 	DisappearingTimerSetAt     int64         `json:"disappearing_timer_set_at,omitempty"`
 	LastSync                   jsontime.Unix `json:"last_sync,omitempty"`
 	CommunityAnnouncementGroup bool          `json:"is_cag,omitempty"`
+	Language                   string        `json:"language,omitempty"`
+
+	// LastCustomerMessage is the time of the last message sent by the customer, which opens
+	// the 24-hour customer service window.
+	LastCustomerMessage jsontime.Unix `json:"last_customer_message,omitempty"`
+
+	// Referral is the ad or post that started the conversation, if it came from one.
+	Referral *PortalReferral `json:"referral,omitempty"`
+}
+
+// PortalReferral is the referral of the message that started the conversation of a portal.
+type PortalReferral struct {
+	types.CloudReferral
+	MessageID  string        `json:"message_id"`
+	ReceivedAt jsontime.Unix `json:"received_at"`
 }
 
 type GhostMetadata struct {
@@ -42,9 +42,9 @@ func MakeUserID(user string) networkid.UserID {
 	return networkid.UserID(user)
 }
 
-func MakeUserKeyUsingBody(body types.CloudEvent, domain string, brmain mxmain.BridgeMain) types.UserKey {
-	name := body.Entry[0].Changes[0].Value.Contacts[0].Profile.Name
-	userID := body.Entry[0].Changes[0].Value.Contacts[0].WaID
+func MakeUserKeyUsingContact(contact types.CloudContact, domain string, brmain mxmain.BridgeMain) types.UserKey {
+	name := contact.Profile.Name
+	userID := contact.WaID
 	userName := brmain.Config.AppService.FormatUsername(userID)
 	userKey := MakeUserKey(name, userName, userID, domain)
 
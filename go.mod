@@ -3,6 +3,7 @@ module github.com/iKonoTelecomunicaciones/whatsapp-go
 go 1.24.2
 
 require (
+	github.com/gorilla/mux v1.8.0
 	github.com/iKonoTelecomunicaciones/go v0.24.2-0.20250620200059-ab2cd269e17a
 	github.com/lib/pq v1.10.9
 	github.com/rs/zerolog v1.34.0
@@ -17,7 +18,6 @@ require (
 	filippo.io/edwards25519 v1.1.0 // indirect
 	github.com/coreos/go-systemd/v22 v22.5.0 // indirect
 	github.com/google/uuid v1.6.0 // indirect
-	github.com/gorilla/mux v1.8.0 // indirect
 	github.com/gorilla/websocket v1.5.0 // indirect
 	github.com/kr/text v0.2.0 // indirect
 	github.com/mattn/go-colorable v0.1.14 // indirect
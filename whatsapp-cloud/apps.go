@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2/status"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/cloudhandle"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog/hlog"
+)
+
+// getAppClient returns the client of the app in the path of the request. Only the owner of
+// the app and the bridge admins can manage it.
+func getAppClient(w http.ResponseWriter, r *http.Request) *cloudhandle.WhatsappCloudClient {
+	wabaID := mux.Vars(r)["waba_id"]
+	user := brmain.Matrix.Provisioning.GetUser(r)
+	userLogin, err := brmain.Bridge.GetExistingUserLoginByID(
+		r.Context(), networkid.UserLoginID(wabaID),
+	)
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Str("waba_id", wabaID).Msg("Failed to get app login")
+		jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"message": "Failed to get the app.",
+		})
+		return nil
+	}
+
+	if userLogin == nil || (userLogin.UserMXID != user.MXID && !user.Permissions.Admin) {
+		hlog.FromRequest(r).Warn().Str("waba_id", wabaID).Msg("App not found for user")
+		jsonResponse(w, http.StatusNotFound, map[string]interface{}{
+			"message": "App not found.",
+		})
+		return nil
+	}
+
+	return whatsappConnector.GetWhatsappCloudClient(r.Context(), userLogin)
+}
+
+// updateAppToken replaces the access token of the app. The new token is checked against the
+// Graph API before it's saved, so a wrong token doesn't stop the app from sending messages.
+func updateAppToken(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	ctx := r.Context()
+	log := hlog.FromRequest(r)
+
+	var body types.CloudUpdateTokenRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		log.Error().Err(err).Msg("Error decoding request body")
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Invalid request body, please check the format and try again.",
+		})
+		return
+	} else if body.AccessToken == "" {
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Missing required fields: access_token.",
+		})
+		return
+	}
+
+	phoneNumber, err := wClient.ValidateAccessToken(ctx, body.AccessToken)
+	if err != nil {
+		log.Warn().Err(err).Msg("The new access token of the app was rejected")
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "The access token can't be used to access the phone number of the app.",
+			"error":   err.Error(),
+		})
+		return
+	}
+
+	wabaID := wClient.GetMetaData(ctx).WabaID
+	err = whatsappConnector.DB.CloudRequest.SetAccessToken(ctx, wabaID, body.AccessToken)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to save the access token of the app")
+		jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"message": "Failed to save the access token of the app.",
+		})
+		return
+	}
+
+	err = wClient.ReplaceAccessToken(ctx, body.AccessToken)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to replace the access token of the login")
+		jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"message": "Failed to save the access token of the app.",
+		})
+		return
+	}
+
+	log.Info().Str("waba_id", wabaID).Msg("Access token of the app replaced")
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message":      "Access token updated successfully",
+		"phone_number": phoneNumber,
+	})
+}
+
+// deleteApp deletes the registration of the app with its cached templates, queued webhooks and
+// processed IDs, then logs out and deletes its login. The rooms of its conversations are also
+// deleted if the cleanup_portals query parameter is true.
+func deleteApp(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	ctx := r.Context()
+	log := hlog.FromRequest(r)
+	login := wClient.UserLogin
+	wabaID := wClient.GetMetaData(ctx).WabaID
+
+	var portals []*bridgev2.Portal
+	if r.URL.Query().Get("cleanup_portals") == "true" {
+		userPortals, err := brmain.Bridge.DB.UserPortal.GetAllForLogin(ctx, login.UserLogin)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to get the portals of the app")
+			jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+				"message": "Failed to get the conversations of the app.",
+			})
+			return
+		}
+
+		for _, userPortal := range userPortals {
+			portal, err := brmain.Bridge.GetExistingPortalByKey(ctx, userPortal.Portal)
+			if err != nil {
+				log.Error().Err(err).Str("portal_id", string(userPortal.Portal.ID)).
+					Msg("Failed to get portal")
+			} else if portal != nil {
+				portals = append(portals, portal)
+			}
+		}
+	}
+
+	// The app is deleted before the login, so a failure doesn't leave an app that has no login
+	// and can't be registered again.
+	db := whatsappConnector.DB
+	err := db.DoTxn(ctx, nil, func(ctx context.Context) error {
+		err := db.Template.DeleteAll(ctx, wabaID)
+		if err != nil {
+			return fmt.Errorf("failed to delete the templates of the app: %w", err)
+		}
+		err = db.WebhookEvent.DeleteAll(ctx, wabaID)
+		if err != nil {
+			return fmt.Errorf("failed to delete the webhook events of the app: %w", err)
+		}
+		err = db.ProcessedMessage.DeleteAll(ctx, wabaID)
+		if err != nil {
+			return fmt.Errorf("failed to delete the processed message IDs of the app: %w", err)
+		}
+		return db.CloudRequest.DeleteApp(ctx, wabaID)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to delete the app")
+		jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"message": "Failed to delete the app.",
+		})
+		return
+	}
+
+	login.Delete(ctx, status.BridgeState{StateEvent: status.StateLoggedOut}, bridgev2.DeleteOpts{
+		LogoutRemote:     true,
+		DontCleanupRooms: true,
+	})
+
+	if len(portals) > 0 {
+		// Deleting the rooms can take a while, so it isn't tied to the request.
+		go bridgev2.DeleteManyPortals(log.WithContext(brmain.Bridge.BackgroundCtx), portals, nil)
+	}
+
+	log.Info().Str("waba_id", wabaID).Int("portals", len(portals)).Msg("App deleted")
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message":         "App deleted successfully",
+		"deleted_portals": len(portals),
+	})
+}
@@ -59,7 +59,8 @@ func startRegistration(
 	log.Info().Msg("Creating new WhatsApp app in the database")
 	new_app, err := whatsappConnector.DB.CloudRequest.CreateApp(
 		r.Context(), body.AppName, user_id,
-		body.WabaID, body.AppPhoneID, body.AccessToken,
+		body.WabaID, body.AppPhoneID, body.AccessToken, body.AppSecret, body.Language,
+		body.VerifyToken, body.ReengagementTemplate, body.ReengagementLanguage,
 	)
 
 	if err != nil {
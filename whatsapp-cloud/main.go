@@ -66,19 +66,44 @@ func main() {
 			)
 		}
 
+		cloudWebhookQueue = newWebhookQueue(whatsappConnector.Config.WhatsApp.CloudWebhookQueue)
+		// The queue stops with the bridge, when its background context is cancelled.
+		cloudWebhookQueue.Start(brmain.Log.WithContext(brmain.Bridge.BackgroundCtx))
+
 		if brmain.Matrix.AS.Router != nil {
 			// Register public endpoints for meta WhatsApp Cloud webhooks.
 			brmain.Matrix.AS.Router.
 				HandleFunc("/cloud/receive", verifyConnection).Methods(http.MethodGet)
 			brmain.Matrix.AS.Router.
 				HandleFunc("/cloud/receive", receive).Methods(http.MethodPost)
+			// Each app can use its own path, so its Meta app can be configured on its own.
+			brmain.Matrix.AS.Router.
+				HandleFunc("/cloud/receive/{app}", verifyConnection).Methods(http.MethodGet)
+			brmain.Matrix.AS.Router.
+				HandleFunc("/cloud/receive/{app}", receive).Methods(http.MethodPost)
 		}
 
 		if brmain.Matrix.Provisioning != nil {
 			// Register provisioning endpoints for meta WhatsApp Cloud.
 			brmain.Matrix.Provisioning.Router.
 				HandleFunc("/v1/register_app", registerApp).Methods(http.MethodPost)
+			brmain.Matrix.Provisioning.Router.
+				HandleFunc("/v1/apps/{waba_id}/token", updateAppToken).Methods(http.MethodPut)
+			brmain.Matrix.Provisioning.Router.
+				HandleFunc("/v1/apps/{waba_id}", deleteApp).Methods(http.MethodDelete)
+
+			// Register provisioning endpoints for the message templates of the apps.
+			templatesRouter := brmain.Matrix.Provisioning.Router.
+				PathPrefix("/v1/apps/{waba_id}/templates").Subrouter()
+			templatesRouter.HandleFunc("", listTemplates).Methods(http.MethodGet)
+			templatesRouter.HandleFunc("", createTemplate).Methods(http.MethodPost)
+			templatesRouter.HandleFunc("/sync", syncTemplates).Methods(http.MethodPost)
+			templatesRouter.HandleFunc("/{template_id}", editTemplate).Methods(http.MethodPut)
+			templatesRouter.HandleFunc("/{name}", deleteTemplate).Methods(http.MethodDelete)
 
+			// Register provisioning endpoints for the ad referrals of the conversations.
+			brmain.Matrix.Provisioning.Router.
+				HandleFunc("/v1/apps/{waba_id}/referrals", listReferrals).Methods(http.MethodGet)
 		}
 	}
 	brmain.InitVersion(Tag, Commit, BuildTime)
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog/hlog"
+)
+
+// listReferrals responds with the referrals of the conversations of the app, so they can be
+// attributed to the ads and posts that started them. The phone query parameter only returns the
+// referral of the conversation with that customer.
+func listReferrals(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	ctx := r.Context()
+	log := hlog.FromRequest(r)
+	phone := r.URL.Query().Get("phone")
+
+	userPortals, err := brmain.Bridge.DB.UserPortal.GetAllForLogin(ctx, wClient.UserLogin.UserLogin)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to get the portals of the app")
+		jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"message": "Failed to get the conversations of the app.",
+		})
+		return
+	}
+
+	referrals := []map[string]interface{}{}
+	for _, userPortal := range userPortals {
+		if phone != "" && string(userPortal.Portal.Receiver) != phone {
+			continue
+		}
+
+		portal, err := brmain.Bridge.GetExistingPortalByKey(ctx, userPortal.Portal)
+		if err != nil {
+			log.Error().Err(err).Str("portal_id", string(userPortal.Portal.ID)).
+				Msg("Failed to get portal")
+			continue
+		} else if portal == nil {
+			continue
+		}
+
+		metadata, ok := portal.Metadata.(*waid.PortalMetadata)
+		if !ok || metadata.Referral == nil {
+			continue
+		}
+
+		referrals = append(referrals, map[string]interface{}{
+			"phone":    string(portal.Receiver),
+			"room_id":  portal.MXID,
+			"referral": metadata.Referral,
+		})
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"referrals": referrals,
+	})
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
+)
+
+const signatureHeader = "X-Hub-Signature-256"
+const signaturePrefix = "sha256="
+
+// getAppSecret returns the secret used to verify the webhooks of the given app.
+// If the app was registered without its own secret, the global one from the config is used.
+func getAppSecret(app *whatsappclouddb.CloudRequest) string {
+	if app != nil && app.AppSecret != "" {
+		return app.AppSecret
+	}
+
+	globalSecret := whatsappConnector.Config.WhatsApp.CloudAppSecret
+	if globalSecret == nil {
+		return ""
+	}
+
+	return *globalSecret
+}
+
+// verifySignature checks the X-Hub-Signature-256 header sent by Meta, which is the
+// HMAC-SHA256 of the raw request body using the app secret as the key.
+func verifySignature(signature string, body []byte, appSecret string) error {
+	if appSecret == "" {
+		return fmt.Errorf("there is no app secret configured to verify the signature")
+	}
+
+	if signature == "" {
+		return fmt.Errorf("the %s header is missing", signatureHeader)
+	}
+
+	hexSignature, found := strings.CutPrefix(signature, signaturePrefix)
+	if !found {
+		return fmt.Errorf("the %s header has an invalid format", signatureHeader)
+	}
+
+	receivedMAC, err := hex.DecodeString(hexSignature)
+	if err != nil {
+		return fmt.Errorf("the %s header is not valid hex: %w", signatureHeader, err)
+	}
+
+	mac := hmac.New(sha256.New, []byte(appSecret))
+	mac.Write(body)
+
+	if !hmac.Equal(receivedMAC, mac.Sum(nil)) {
+		return fmt.Errorf("the %s header doesn't match the request body", signatureHeader)
+	}
+
+	return nil
+}
+
+// getVerifyToken returns the token used to verify the webhook subscription of the given app.
+// If the app was registered without its own token, the global one from the config is used.
+func getVerifyToken(app *whatsappclouddb.CloudRequest) string {
+	if app != nil && app.VerifyToken != "" {
+		return app.VerifyToken
+	}
+
+	globalToken := whatsappConnector.Config.WhatsApp.CloudVerifyToken
+	if globalToken == nil {
+		return ""
+	}
+
+	return *globalToken
+}
+
+// isValidVerifyToken checks the hub.verify_token sent by Meta. If the request was sent to the
+// path of an app, the token of that app is used. Otherwise the token can be the global one or
+// the token of any registered app.
+func isValidVerifyToken(ctx context.Context, wabaID string, token string) (bool, error) {
+	if token == "" {
+		return false, nil
+	}
+
+	if wabaID != "" {
+		apps, err := whatsappConnector.DB.CloudRequest.SearchApp(ctx, wabaID, "", "")
+		if err != nil {
+			return false, fmt.Errorf("failed to search app [%s]: %w", wabaID, err)
+		}
+
+		if len(apps) == 0 {
+			return false, nil
+		}
+
+		return tokensMatch(getVerifyToken(apps[0]), token), nil
+	}
+
+	if tokensMatch(getVerifyToken(nil), token) {
+		return true, nil
+	}
+
+	apps, err := whatsappConnector.DB.CloudRequest.SearchAppsByVerifyToken(ctx, token)
+	if err != nil {
+		return false, fmt.Errorf("failed to search apps by verify token: %w", err)
+	}
+
+	return len(apps) > 0, nil
+}
+
+// tokensMatch compares the tokens in constant time, an empty expected token never matches.
+func tokensMatch(expected string, received string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(expected), []byte(received)) == 1
+}
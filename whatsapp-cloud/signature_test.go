@@ -0,0 +1,98 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+)
+
+func signBody(body []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifySignature(t *testing.T) {
+	body := []byte(`{"object":"whatsapp_business_account","entry":[]}`)
+	validSignature := signBody(body, "secret")
+	validHex := strings.TrimPrefix(validSignature, signaturePrefix)
+
+	tests := []struct {
+		name      string
+		signature string
+		body      []byte
+		appSecret string
+		wantErr   bool
+	}{
+		{name: "valid", signature: validSignature, body: body, appSecret: "secret"},
+		{
+			name:      "valid with uppercase hex",
+			signature: signaturePrefix + strings.ToUpper(validHex),
+			body:      body,
+			appSecret: "secret",
+		},
+		{
+			name:      "valid with empty body",
+			signature: signBody(nil, "secret"),
+			body:      nil,
+			appSecret: "secret",
+		},
+		{
+			name:      "wrong secret",
+			signature: validSignature,
+			body:      body,
+			appSecret: "other",
+			wantErr:   true,
+		},
+		{
+			name:      "modified body",
+			signature: validSignature,
+			body:      append([]byte(" "), body...),
+			appSecret: "secret",
+			wantErr:   true,
+		},
+		{name: "no app secret", signature: validSignature, body: body, wantErr: true},
+		{name: "missing header", body: body, appSecret: "secret", wantErr: true},
+		{
+			name:      "missing prefix",
+			signature: validHex,
+			body:      body,
+			appSecret: "secret",
+			wantErr:   true,
+		},
+		{
+			name:      "sha1 signature",
+			signature: "sha1=" + validHex,
+			body:      body,
+			appSecret: "secret",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid hex",
+			signature: signaturePrefix + "xyz",
+			body:      body,
+			appSecret: "secret",
+			wantErr:   true,
+		},
+		{
+			name:      "truncated signature",
+			signature: validSignature[:len(validSignature)-2],
+			body:      body,
+			appSecret: "secret",
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := verifySignature(test.signature, test.body, test.appSecret)
+			if test.wantErr && err == nil {
+				t.Error("verifySignature() error = nil, want an error")
+			} else if !test.wantErr && err != nil {
+				t.Errorf("verifySignature() error = %v", err)
+			}
+		})
+	}
+}
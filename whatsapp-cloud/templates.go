@@ -0,0 +1,154 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog/hlog"
+)
+
+// templateErrorResponse responds with the error of a failed template request.
+func templateErrorResponse(w http.ResponseWriter, r *http.Request, err error, message string) {
+	hlog.FromRequest(r).Error().Err(err).Msg(message)
+	jsonResponse(w, http.StatusBadGateway, map[string]interface{}{
+		"message": message,
+		"error":   err.Error(),
+	})
+}
+
+// listTemplates responds with the cached templates of the app. The templates are synced with
+// the Graph API first if the sync query parameter is true or if there are no cached templates.
+func listTemplates(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	var err error
+	var templates any
+	if r.URL.Query().Get("sync") == "true" {
+		templates, err = wClient.SyncTemplates(r.Context())
+	} else {
+		templates, err = wClient.GetTemplates(r.Context())
+	}
+
+	if err != nil {
+		templateErrorResponse(w, r, err, "Failed to get the message templates.")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"templates": templates,
+	})
+}
+
+// syncTemplates refreshes the cached templates of the app with the Graph API.
+func syncTemplates(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	templates, err := wClient.SyncTemplates(r.Context())
+	if err != nil {
+		templateErrorResponse(w, r, err, "Failed to sync the message templates.")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message":   "Message templates synced successfully",
+		"templates": templates,
+	})
+}
+
+// createTemplate submits a new template of the app for approval.
+func createTemplate(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	var body types.CloudTemplate
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("Error decoding request body")
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Invalid request body, please check the format and try again.",
+		})
+		return
+	}
+
+	if body.Name == "" || body.Language == "" || body.Category == "" || len(body.Components) == 0 {
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Missing required fields: name, language, category, components.",
+		})
+		return
+	}
+
+	template, err := wClient.CreateTemplate(r.Context(), body)
+	if err != nil {
+		templateErrorResponse(w, r, err, "Failed to create the message template.")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message":  "Message template created successfully",
+		"template": template,
+	})
+}
+
+// editTemplate changes the category or the components of a template of the app.
+func editTemplate(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	var body types.CloudTemplateEditRequest
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("Error decoding request body")
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Invalid request body, please check the format and try again.",
+		})
+		return
+	}
+
+	if body.Category == "" && len(body.Components) == 0 {
+		jsonResponse(w, http.StatusBadRequest, map[string]interface{}{
+			"message": "Missing required fields: category or components.",
+		})
+		return
+	}
+
+	template, err := wClient.EditTemplate(r.Context(), mux.Vars(r)["template_id"], body)
+	if err != nil {
+		templateErrorResponse(w, r, err, "Failed to edit the message template.")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message":  "Message template edited successfully",
+		"template": template,
+	})
+}
+
+// deleteTemplate deletes every language of a template of the app by its name.
+func deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	wClient := getAppClient(w, r)
+	if wClient == nil {
+		return
+	}
+
+	err := wClient.DeleteTemplate(r.Context(), mux.Vars(r)["name"])
+	if err != nil {
+		templateErrorResponse(w, r, err, "Failed to delete the message template.")
+		return
+	}
+
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message": "Message template deleted successfully",
+	})
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/cloudhandle"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+	"github.com/rs/zerolog"
+)
+
+// webhookQueue processes the webhooks saved in the database in the background. The events with
+// the same ordering key are never processed at the same time, so the order of each portal is kept.
+type webhookQueue struct {
+	config   cloudhandle.WebhookQueueConfig
+	events   chan *whatsappclouddb.WebhookEvent
+	wakeup   chan struct{}
+	inFlight atomic.Int32
+}
+
+var cloudWebhookQueue *webhookQueue
+
+// newWebhookQueue creates a queue with the given config, using the default values for the
+// settings that aren't configured.
+func newWebhookQueue(config *cloudhandle.WebhookQueueConfig) *webhookQueue {
+	queueConfig := cloudhandle.WebhookQueueConfig{
+		Workers:       4,
+		MaxAttempts:   8,
+		RetryDelay:    5,
+		MaxRetryDelay: 600,
+		PollInterval:  2,
+		LockTimeout:   300,
+	}
+
+	if config != nil {
+		if config.Workers > 0 {
+			queueConfig.Workers = config.Workers
+		}
+		if config.MaxAttempts > 0 {
+			queueConfig.MaxAttempts = config.MaxAttempts
+		}
+		if config.RetryDelay > 0 {
+			queueConfig.RetryDelay = config.RetryDelay
+		}
+		if config.MaxRetryDelay > 0 {
+			queueConfig.MaxRetryDelay = config.MaxRetryDelay
+		}
+		if config.PollInterval > 0 {
+			queueConfig.PollInterval = config.PollInterval
+		}
+		if config.LockTimeout > 0 {
+			queueConfig.LockTimeout = config.LockTimeout
+		}
+	}
+
+	return &webhookQueue{
+		config: queueConfig,
+		events: make(chan *whatsappclouddb.WebhookEvent, queueConfig.Workers),
+		wakeup: make(chan struct{}, 1),
+	}
+}
+
+// Start launches the dispatcher and the workers of the queue.
+func (queue *webhookQueue) Start(ctx context.Context) {
+	zerolog.Ctx(ctx).Info().Int("workers", queue.config.Workers).Msg("Starting webhook queue")
+
+	for range queue.config.Workers {
+		go queue.worker(ctx)
+	}
+	go queue.dispatcher(ctx)
+}
+
+// Notify wakes up the dispatcher to check for new events.
+func (queue *webhookQueue) Notify() {
+	select {
+	case queue.wakeup <- struct{}{}:
+	default:
+	}
+}
+
+// Enqueue saves the given entries in the database and wakes up the dispatcher. The entries are
+// saved in a single transaction, so a failed webhook that is sent again isn't queued twice.
+func (queue *webhookQueue) Enqueue(ctx context.Context, entries []queuedEntry) error {
+	err := whatsappConnector.DB.DoTxn(ctx, nil, func(ctx context.Context) error {
+		for _, queued := range entries {
+			payload, err := json.Marshal(queued.Entry)
+			if err != nil {
+				return fmt.Errorf("failed to marshal entry of [%s]: %w", queued.Entry.ID, err)
+			}
+
+			err = whatsappConnector.DB.WebhookEvent.Insert(
+				ctx, queued.Entry.ID, queued.OrderingKey, string(payload),
+			)
+			if err != nil {
+				return fmt.Errorf("failed to save entry of [%s]: %w", queued.Entry.ID, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	queue.Notify()
+	return nil
+}
+
+// dispatcher claims the events that are ready to be processed and hands them to the workers.
+// It runs when a webhook is received, when a worker is free and every poll interval,
+// so the events waiting for a retry are picked up.
+// The channel of the workers is closed when the context is cancelled, so they stop too.
+func (queue *webhookQueue) dispatcher(ctx context.Context) {
+	ticker := time.NewTicker(time.Duration(queue.config.PollInterval) * time.Second)
+	defer ticker.Stop()
+	defer close(queue.events)
+
+	for {
+		queue.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-queue.wakeup:
+		}
+	}
+}
+
+func (queue *webhookQueue) dispatch(ctx context.Context) {
+	log := zerolog.Ctx(ctx)
+
+	err := whatsappConnector.DB.WebhookEvent.ReleaseStale(ctx)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to release stale webhook events")
+	}
+
+	free := queue.config.Workers - int(queue.inFlight.Load())
+	if free <= 0 {
+		return
+	}
+
+	lockUntil := time.Now().Add(time.Duration(queue.config.LockTimeout) * time.Second)
+	events, err := whatsappConnector.DB.WebhookEvent.Claim(ctx, free, lockUntil)
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to claim webhook events")
+	}
+
+	for _, evt := range events {
+		queue.inFlight.Add(1)
+		select {
+		case queue.events <- evt:
+		case <-ctx.Done():
+			// The events that weren't handed out are released when their lock expires.
+			queue.inFlight.Add(-1)
+			return
+		}
+	}
+}
+
+func (queue *webhookQueue) worker(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-queue.events:
+			if !ok || ctx.Err() != nil {
+				return
+			}
+
+			stopLock := queue.keepLocked(ctx, evt)
+			queue.process(ctx, evt)
+			stopLock()
+			queue.inFlight.Add(-1)
+			queue.Notify()
+		}
+	}
+}
+
+// keepLocked extends the lock of an event every half of the lock timeout until the returned
+// function is called, so slow events aren't released and processed twice.
+func (queue *webhookQueue) keepLocked(
+	ctx context.Context, evt *whatsappclouddb.WebhookEvent,
+) context.CancelFunc {
+	lockCtx, cancel := context.WithCancel(ctx)
+	lockTimeout := time.Duration(queue.config.LockTimeout) * time.Second
+
+	go func() {
+		ticker := time.NewTicker(lockTimeout / 2)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-lockCtx.Done():
+				return
+			case <-ticker.C:
+				err := whatsappConnector.DB.WebhookEvent.ExtendLock(
+					lockCtx, evt.ID, time.Now().Add(lockTimeout),
+				)
+				if err != nil && lockCtx.Err() == nil {
+					zerolog.Ctx(ctx).Error().Err(err).Int64("webhook_event_id", evt.ID).
+						Msg("Failed to extend the lock of webhook event")
+				}
+			}
+		}
+	}()
+
+	return cancel
+}
+
+// process handles a single event, deleting it if it succeeds. Failed events are retried with
+// an exponential backoff until the maximum number of attempts, then they are marked as dead.
+// Events that only failed with permanent errors are marked as dead right away.
+func (queue *webhookQueue) process(ctx context.Context, evt *whatsappclouddb.WebhookEvent) {
+	log := zerolog.Ctx(ctx).With().
+		Int64("webhook_event_id", evt.ID).
+		Str("ordering_key", evt.OrderingKey).
+		Int("attempt", evt.Attempts+1).
+		Logger()
+	ctx = log.WithContext(ctx)
+	if evt.Attempts+1 >= queue.config.MaxAttempts {
+		ctx = cloudhandle.WithLastAttempt(ctx)
+	}
+
+	var entry types.CloudEntry
+	err := json.Unmarshal([]byte(evt.Payload), &entry)
+
+	if err != nil {
+		// The payload will never be valid, so there's no point in retrying it.
+		log.Error().Err(err).Msg("Failed to decode webhook event, moving it to dead-letter")
+		evt.Attempts++
+		queue.markDead(ctx, evt, err)
+		return
+	}
+
+	retryEntry, err := handleCloudEntry(ctx, entry)
+	if err == nil {
+		err = whatsappConnector.DB.WebhookEvent.Delete(ctx, evt.ID)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to delete processed webhook event")
+		}
+		return
+	}
+
+	evt.Attempts++
+	if retryEntry == nil {
+		// None of the failures would be fixed by retrying the event.
+		log.Error().Err(err).Msg("Webhook event can't be processed, moving it to dead-letter")
+		queue.markDead(ctx, evt, err)
+		return
+	}
+
+	// Only the statuses and messages that failed are retried, the rest were already bridged.
+	payload, marshalErr := json.Marshal(retryEntry)
+	if marshalErr != nil {
+		log.Error().Err(marshalErr).Msg("Failed to marshal the failed part of the webhook event")
+	} else {
+		evt.Payload = string(payload)
+	}
+
+	if evt.Attempts >= queue.config.MaxAttempts {
+		log.Error().Err(err).Msg("Webhook event failed too many times, moving it to dead-letter")
+		queue.markDead(ctx, evt, err)
+		return
+	}
+
+	nextAttemptAt := time.Now().Add(queue.retryDelay(evt.Attempts))
+	log.Warn().Err(err).Time("next_attempt_at", nextAttemptAt).
+		Msg("Webhook event failed, retrying later")
+
+	err = whatsappConnector.DB.WebhookEvent.Retry(ctx, evt, nextAttemptAt, err.Error())
+	if err != nil {
+		log.Error().Err(err).Msg("Failed to schedule retry of webhook event")
+	}
+}
+
+func (queue *webhookQueue) markDead(
+	ctx context.Context, evt *whatsappclouddb.WebhookEvent, processErr error,
+) {
+	err := whatsappConnector.DB.WebhookEvent.MarkDead(ctx, evt, processErr.Error())
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("Failed to move webhook event to dead-letter")
+	}
+}
+
+// retryDelay returns the delay before the next attempt, doubling it after every failed attempt.
+func (queue *webhookQueue) retryDelay(attempts int) time.Duration {
+	delay := time.Duration(queue.config.RetryDelay) * time.Second
+	maxDelay := time.Duration(queue.config.MaxRetryDelay) * time.Second
+
+	for i := 1; i < attempts && delay < maxDelay; i++ {
+		delay *= 2
+	}
+
+	return min(delay, maxDelay)
+}
+
+// queuedEntry is the part of an entry that belongs to a single ordering key.
+type queuedEntry struct {
+	OrderingKey string
+	Entry       types.CloudEntry
+}
+
+// splitCloudEntry splits the changes of an entry by customer, so the messages and statuses of
+// different customers can be processed in parallel. Changes without a customer are kept together
+// using the WABA ID as the ordering key.
+func splitCloudEntry(entry types.CloudEntry) []queuedEntry {
+	var keys []string
+	changesByKey := map[string][]types.CloudChange{}
+
+	addChange := func(key string, change types.CloudChange) {
+		if _, ok := changesByKey[key]; !ok {
+			keys = append(keys, key)
+		}
+		changesByKey[key] = append(changesByKey[key], change)
+	}
+
+	for _, change := range entry.Changes {
+		value := change.Value
+
+		if len(value.Messages) == 0 && (value.Statuses == nil || len(*value.Statuses) == 0) {
+			addChange(entry.ID, change)
+			continue
+		}
+
+		var customers []string
+		values := map[string]*types.CloudValue{}
+
+		getValue := func(customer string) *types.CloudValue {
+			if customerValue, ok := values[customer]; ok {
+				return customerValue
+			}
+			customers = append(customers, customer)
+			values[customer] = &types.CloudValue{
+				MessagingProduct: value.MessagingProduct,
+				Metadata:         value.Metadata,
+			}
+			return values[customer]
+		}
+
+		if value.Statuses != nil {
+			for _, messageStatus := range *value.Statuses {
+				customerValue := getValue(messageStatus.RecipientID)
+				if customerValue.Statuses == nil {
+					customerValue.Statuses = &types.CloudStatuses{}
+				}
+				*customerValue.Statuses = append(*customerValue.Statuses, messageStatus)
+			}
+		}
+
+		for index, message := range value.Messages {
+			customerValue := getValue(message.From)
+			customerValue.Messages = append(customerValue.Messages, message)
+
+			// The contact is added for every message, so the contacts keep the order of the messages.
+			contact := findMessageContact(value.Contacts, index, message)
+			if contact != nil {
+				customerValue.Contacts = append(customerValue.Contacts, *contact)
+			}
+		}
+
+		for _, customer := range customers {
+			addChange(entry.ID+":"+customer, types.CloudChange{
+				Value: *values[customer],
+				Field: change.Field,
+			})
+		}
+	}
+
+	queued := make([]queuedEntry, 0, len(keys))
+	for _, key := range keys {
+		queued = append(queued, queuedEntry{
+			OrderingKey: key,
+			Entry: types.CloudEntry{
+				ID:      entry.ID,
+				Changes: changesByKey[key],
+			},
+		})
+	}
+
+	return queued
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/cloudhandle"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
+)
+
+// summarizeQueuedEntry returns the IDs of the messages, statuses and contacts of a queued entry,
+// with the field of every change.
+func summarizeQueuedEntry(queued queuedEntry) []string {
+	var summary []string
+	for _, change := range queued.Entry.Changes {
+		summary = append(summary, "field:"+change.Field)
+		if change.Value.Statuses != nil {
+			for _, messageStatus := range *change.Value.Statuses {
+				summary = append(summary, "status:"+messageStatus.ID)
+			}
+		}
+		for _, message := range change.Value.Messages {
+			summary = append(summary, "message:"+message.ID)
+		}
+		for _, contact := range change.Value.Contacts {
+			summary = append(summary, "contact:"+contact.WaID)
+		}
+	}
+	return summary
+}
+
+func TestSplitCloudEntry(t *testing.T) {
+	tests := []struct {
+		name  string
+		entry string
+		want  map[string][]string
+		keys  []string
+	}{
+		{
+			name: "messages of different customers",
+			entry: `{"id": "waba", "changes": [{"field": "messages", "value": {
+				"contacts": [{"wa_id": "111"}, {"wa_id": "222"}],
+				"messages": [
+					{"id": "m1", "from": "111"},
+					{"id": "m2", "from": "222"},
+					{"id": "m3", "from": "111"}
+				]
+			}}]}`,
+			keys: []string{"waba:111", "waba:222"},
+			want: map[string][]string{
+				"waba:111": {
+					"field:messages", "message:m1", "message:m3", "contact:111", "contact:111",
+				},
+				"waba:222": {"field:messages", "message:m2", "contact:222"},
+			},
+		},
+		{
+			name: "statuses are grouped with the messages of the customer",
+			entry: `{"id": "waba", "changes": [{"field": "messages", "value": {
+				"statuses": [
+					{"id": "s1", "recipient_id": "222"},
+					{"id": "s2", "recipient_id": "111"}
+				],
+				"contacts": [{"wa_id": "111"}],
+				"messages": [{"id": "m1", "from": "111"}]
+			}}]}`,
+			keys: []string{"waba:222", "waba:111"},
+			want: map[string][]string{
+				"waba:222": {"field:messages", "status:s1"},
+				"waba:111": {"field:messages", "status:s2", "message:m1", "contact:111"},
+			},
+		},
+		{
+			name: "contact matched by index",
+			entry: `{"id": "waba", "changes": [{"field": "messages", "value": {
+				"contacts": [{"wa_id": "other"}],
+				"messages": [{"id": "m1", "from": "111"}]
+			}}]}`,
+			keys: []string{"waba:111"},
+			want: map[string][]string{
+				"waba:111": {"field:messages", "message:m1", "contact:other"},
+			},
+		},
+		{
+			name: "changes without customer use the WABA ID",
+			entry: `{"id": "waba", "changes": [
+				{"field": "message_template_status_update", "value": {"event": "APPROVED"}},
+				{"field": "messages", "value": {"messages": [{"id": "m1", "from": "111"}]}},
+				{"field": "account_update", "value": {}}
+			]}`,
+			keys: []string{"waba", "waba:111"},
+			want: map[string][]string{
+				"waba":     {"field:message_template_status_update", "field:account_update"},
+				"waba:111": {"field:messages", "message:m1"},
+			},
+		},
+		{
+			name:  "no changes",
+			entry: `{"id": "waba", "changes": []}`,
+			want:  map[string][]string{},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var entry types.CloudEntry
+			err := json.Unmarshal([]byte(test.entry), &entry)
+			if err != nil {
+				t.Fatalf("failed to parse entry: %v", err)
+			}
+
+			queued := splitCloudEntry(entry)
+
+			var keys []string
+			got := map[string][]string{}
+			for _, item := range queued {
+				if item.Entry.ID != entry.ID {
+					t.Errorf(
+						"entry ID of %s = %s, want %s", item.OrderingKey, item.Entry.ID, entry.ID,
+					)
+				}
+				keys = append(keys, item.OrderingKey)
+				got[item.OrderingKey] = summarizeQueuedEntry(item)
+			}
+
+			if !reflect.DeepEqual(keys, test.keys) {
+				t.Errorf("ordering keys = %v, want %v", keys, test.keys)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("splitCloudEntry() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	queue := newWebhookQueue(&cloudhandle.WebhookQueueConfig{RetryDelay: 5, MaxRetryDelay: 60})
+
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{attempts: 0, want: 5 * time.Second},
+		{attempts: 1, want: 5 * time.Second},
+		{attempts: 2, want: 10 * time.Second},
+		{attempts: 3, want: 20 * time.Second},
+		{attempts: 4, want: 40 * time.Second},
+		{attempts: 5, want: 60 * time.Second},
+		{attempts: 100, want: 60 * time.Second},
+	}
+
+	for _, test := range tests {
+		got := queue.retryDelay(test.attempts)
+		if got != test.want {
+			t.Errorf("retryDelay(%d) = %s, want %s", test.attempts, got, test.want)
+		}
+	}
+}
+
+func TestRetryDelayDefaults(t *testing.T) {
+	queue := newWebhookQueue(nil)
+
+	if got := queue.retryDelay(1); got != 5*time.Second {
+		t.Errorf("retryDelay(1) = %s, want 5s", got)
+	}
+	if got := queue.retryDelay(100); got != 10*time.Minute {
+		t.Errorf("retryDelay(100) = %s, want 10m", got)
+	}
+}
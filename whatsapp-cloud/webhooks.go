@@ -1,16 +1,31 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"sync/atomic"
 
+	"github.com/gorilla/mux"
+	"github.com/iKonoTelecomunicaciones/go/bridgev2"
 	"github.com/iKonoTelecomunicaciones/go/bridgev2/networkid"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/cloudhandle"
+	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/connector/whatsappclouddb"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/types"
 	"github.com/iKonoTelecomunicaciones/whatsapp-go/core/waid"
+	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/hlog"
 )
 
+// maxWebhookBodySize is the maximum size of a webhook body that will be read from Meta.
+const maxWebhookBodySize = 10 * 1024 * 1024
+
+// rejectedWebhooks counts the webhooks rejected because their signature couldn't be verified.
+var rejectedWebhooks atomic.Uint64
+
 func receive(w http.ResponseWriter, r *http.Request) {
 	// This endpoint is used to receive provision requests from Meta WhatsApp Cloud.
 	// It checks if the request is valid and then processes the event accordingly.
@@ -18,9 +33,21 @@ func receive(w http.ResponseWriter, r *http.Request) {
 
 	var body types.CloudEvent
 	ctx := r.Context()
-	err := json.NewDecoder(r.Body).Decode(&body)
+
+	// The raw body is needed to verify the signature, so it can't be streamed to the decoder.
+	rawBody, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBodySize))
 
 	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("Error reading request body")
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"message": "Invalid request body",
+		})
+		return
+	}
+
+	err = json.Unmarshal(rawBody, &body)
+
+	if err != nil || len(body.Entry) == 0 {
 		hlog.FromRequest(r).Error().Err(err).Msg("Error decoding request body")
 		jsonResponse(w, http.StatusOK, map[string]interface{}{
 			"message": "Invalid request body",
@@ -30,26 +57,45 @@ func receive(w http.ResponseWriter, r *http.Request) {
 
 	hlog.FromRequest(r).Info().Interface("body", body).Msg("Event body: ")
 
-	// Get the business id and the value of the event
-	wb_business_id := body.Entry[0].ID
-	wb_value := body.Entry[0].Changes[0].Value
+	// Validate which of the apps of the entries are registered, the entries of the apps that
+	// aren't registered are ignored. If the webhook was sent to the path of an app, only the
+	// entries of that app are accepted.
+	registeredApps := map[string]*whatsappclouddb.CloudRequest{}
+	var signingApp *whatsappclouddb.CloudRequest
+	pathApp := mux.Vars(r)["app"]
 
-	// Validate if the app is registered
-	app_registered, err := whatsappConnector.DB.CloudRequest.SearchApp(ctx, wb_business_id, "", "")
+	for _, entry := range body.Entry {
+		if pathApp != "" && entry.ID != pathApp {
+			hlog.FromRequest(r).Warn().Msgf(
+				"Ignoring entry of whatsapp_app [%s] sent to the path of [%s]", entry.ID, pathApp,
+			)
+			continue
+		}
 
-	if err != nil {
-		hlog.FromRequest(r).Error().Err(err).Msg("Error while searching for whatsapp app")
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
-			"message": "Error while searching for whatsapp app",
-		})
-		return
+		app_registered, err := whatsappConnector.DB.CloudRequest.SearchApp(ctx, entry.ID, "", "")
+
+		if err != nil {
+			hlog.FromRequest(r).Error().Err(err).Msg("Error while searching for whatsapp app")
+			jsonResponse(w, http.StatusOK, map[string]interface{}{
+				"message": "Error while searching for whatsapp app",
+			})
+			return
+		}
+
+		if len(app_registered) == 0 {
+			hlog.FromRequest(r).Warn().Msgf(
+				"Ignoring entry because the whatsapp_app [%s] is not registered.", entry.ID,
+			)
+			continue
+		}
+
+		registeredApps[entry.ID] = app_registered[0]
+		if signingApp == nil {
+			signingApp = app_registered[0]
+		}
 	}
 
-	if len(app_registered) == 0 {
-		hlog.FromRequest(r).Warn().Msgf(
-			"Ignoring event because the whatsapp_app [%s] is not registered.",
-			wb_business_id,
-		)
+	if signingApp == nil {
 		// If the app is not registered, we return a 200 OK response to acknowledge the event
 		// and avoid further processing.
 		// This is important to prevent WhatsApp from retrying the event.
@@ -59,64 +105,227 @@ func receive(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userLogin, err := brmain.Bridge.GetExistingUserLoginByID(
-		ctx, networkid.UserLoginID(wb_business_id),
-	)
+	// Validate that the event was signed by Meta with the secret of the app
+	err = verifySignature(r.Header.Get(signatureHeader), rawBody, getAppSecret(signingApp))
 
-	if userLogin == nil {
-		hlog.FromRequest(r).Error().Msg("User login not found for request")
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
-			"message": "User login not found for request",
+	if err != nil {
+		hlog.FromRequest(r).Warn().Err(err).
+			Uint64("rejected_webhooks", rejectedWebhooks.Add(1)).
+			Msgf("Rejecting event for whatsapp_app [%s] with an invalid signature", signingApp.WabaPhoneID)
+		jsonResponse(w, http.StatusUnauthorized, map[string]interface{}{
+			"message": "Invalid signature",
 		})
 		return
 	}
 
-	//Validate if the event is not a message.
-	if wb_value.Messages == nil {
-		hlog.FromRequest(r).Warn().Msgf(
-			"Ignoring event because the integration type is not supported.",
-		)
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
-			"message": "Integration type not supported. Only messages are supported.",
+	// The entries are saved and processed in the background, so Meta gets the answer right away
+	// and doesn't send the webhook again while the homeserver is slow.
+	var queued []queuedEntry
+
+	for _, entry := range body.Entry {
+		if registeredApps[entry.ID] == nil {
+			continue
+		}
+
+		queued = append(queued, splitCloudEntry(entry)...)
+	}
+
+	err = cloudWebhookQueue.Enqueue(ctx, queued)
+
+	if err != nil {
+		// If the event can't be saved, an error is returned so Meta sends it again later.
+		hlog.FromRequest(r).Error().Err(err).Msg("Error while queueing cloud event")
+		jsonResponse(w, http.StatusInternalServerError, map[string]interface{}{
+			"message": "Error while queueing cloud event",
 		})
 		return
 	}
 
+	jsonResponse(w, http.StatusOK, map[string]interface{}{
+		"message": "Message event queued successfully",
+	})
+	return
+}
+
+// handleCloudEntry sends every change of an entry to the user login of its WABA ID. The part of
+// the entry that failed and can be retried is returned with the errors, it's nil if none of the
+// failures can be fixed by retrying.
+func handleCloudEntry(ctx context.Context, entry types.CloudEntry) (*types.CloudEntry, error) {
+	log := zerolog.Ctx(ctx).With().Str("waba_id", entry.ID).Logger()
+
+	userLogin, err := brmain.Bridge.GetExistingUserLoginByID(
+		ctx, networkid.UserLoginID(entry.ID),
+	)
+
+	if err != nil {
+		log.Error().Err(err).Msg("Error while getting user login")
+		return &entry, fmt.Errorf("error while getting user login for [%s]: %w", entry.ID, err)
+	}
+
+	if userLogin == nil {
+		log.Error().Msg("User login not found for request")
+		return nil, fmt.Errorf(
+			"%w: user login not found for [%s]", cloudhandle.ErrPermanentFailure, entry.ID,
+		)
+	}
+
+	var retryChanges []types.CloudChange
+	var changeErrors []error
+
+	for _, change := range entry.Changes {
+		retryChange, err := handleCloudChange(ctx, userLogin, change)
+		if err != nil {
+			changeErrors = append(changeErrors, err)
+		}
+		if retryChange != nil {
+			retryChanges = append(retryChanges, *retryChange)
+		}
+	}
+
+	if len(retryChanges) == 0 {
+		return nil, errors.Join(changeErrors...)
+	}
+
+	return &types.CloudEntry{ID: entry.ID, Changes: retryChanges}, errors.Join(changeErrors...)
+}
+
+// handleCloudChange handles every message of a change on its own. The messages are processed
+// in the order they were received, so the order within each portal is kept. The statuses and
+// messages that failed and can be retried are returned as a new change.
+func handleCloudChange(
+	ctx context.Context, userLogin *bridgev2.UserLogin, change types.CloudChange,
+) (*types.CloudChange, error) {
+	log := zerolog.Ctx(ctx).With().Str("field", change.Field).Logger()
+	value := change.Value
+
+	if change.Field == "message_template_status_update" {
+		wClient := whatsappConnector.GetWhatsappCloudClient(ctx, userLogin)
+		err := wClient.HandleTemplateStatusUpdate(ctx, value)
+		if err != nil {
+			return &change, err
+		}
+		return nil, nil
+	}
+
+	//Validate if the event is not a message or a status.
+	if len(value.Messages) == 0 && value.Statuses == nil {
+		log.Warn().Msg("Ignoring change because the integration type is not supported.")
+		return nil, nil
+	}
+
 	domain := brmain.Config.Homeserver.Domain
-	userKey := waid.MakeUserKeyUsingBody(body, domain, brmain)
+	wClient := whatsappConnector.GetWhatsappCloudClient(ctx, userLogin)
+
+	retryValue := types.CloudValue{
+		MessagingProduct: value.MessagingProduct,
+		Metadata:         value.Metadata,
+	}
+	var messageErrors []error
+
+	if value.Statuses != nil {
+		failedStatuses, err := wClient.HandleCloudStatuses(ctx, *value.Statuses)
+
+		if err != nil {
+			log.Error().Err(err).Msg("Error while handling cloud statuses")
+			messageErrors = append(messageErrors, err)
+		}
+		if len(failedStatuses) > 0 {
+			retryValue.Statuses = &failedStatuses
+		}
+	}
+
+	for index, message := range value.Messages {
+		contact := findMessageContact(value.Contacts, index, message)
+
+		if contact == nil {
+			log.Error().Str("message_id", message.ID).Msg("Contact not found for message")
+			messageErrors = append(messageErrors, fmt.Errorf(
+				"%w: contact not found for message %s", cloudhandle.ErrPermanentFailure, message.ID,
+			))
+			continue
+		}
+
+		err := handleCloudMessage(ctx, userLogin, wClient, value, message, *contact, domain)
+		if err == nil {
+			continue
+		}
+
+		messageErrors = append(messageErrors, err)
+		if errors.Is(err, cloudhandle.ErrPermanentFailure) {
+			log.Error().Err(err).Str("message_id", message.ID).
+				Msg("Dropping cloud message that can't be handled")
+			continue
+		}
+
+		retryValue.Messages = append(retryValue.Messages, message)
+		retryValue.Contacts = append(retryValue.Contacts, *contact)
+	}
+
+	if len(retryValue.Messages) == 0 && retryValue.Statuses == nil {
+		return nil, errors.Join(messageErrors...)
+	}
+
+	return &types.CloudChange{Value: retryValue, Field: change.Field}, errors.Join(messageErrors...)
+}
+
+// handleCloudMessage sends a single message of a change to the portal of its customer.
+func handleCloudMessage(
+	ctx context.Context,
+	userLogin *bridgev2.UserLogin,
+	wClient *cloudhandle.WhatsappCloudClient,
+	value types.CloudValue,
+	message types.CloudMessage,
+	contact types.CloudContact,
+	domain string,
+) error {
+	log := zerolog.Ctx(ctx)
+
+	userKey := waid.MakeUserKeyUsingContact(contact, domain, brmain)
 	portal, err := whatsappConnector.GetPortal(ctx, userLogin, brmain, userKey)
 
 	if err != nil {
-		hlog.FromRequest(r).Error().Err(err).Msg("Error while getting portal")
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
-			"message": "Error while getting portal",
-		})
-		return
+		log.Error().Err(err).Msg("Error while getting portal")
+		return fmt.Errorf("error while getting portal: %w", err)
 	}
 
 	if portal == nil {
-		hlog.FromRequest(r).Error().Msg("Portal not found to handle remote event")
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
-			"message": "Portal not found to handle remote event",
-		})
-		return
+		log.Error().Msg("Portal not found to handle remote event")
+		return fmt.Errorf("portal not found for message %s", message.ID)
 	}
 
-	wClient := whatsappConnector.GetWhatsappCloudClient(ctx, userLogin)
-	err = wClient.HandleCloudMessage(ctx, body, portal)
+	// Each message is handled with its own contact, so the converters only see one pair.
+	messageValue := types.CloudValue{
+		MessagingProduct: value.MessagingProduct,
+		Metadata:         value.Metadata,
+		Contacts:         []types.CloudContact{contact},
+		Messages:         []types.CloudMessage{message},
+	}
+
+	err = wClient.HandleCloudMessage(ctx, messageValue, portal)
 
 	if err != nil {
-		hlog.FromRequest(r).Error().Err(err).Msg("Error while handling cloud message")
-		jsonResponse(w, http.StatusOK, map[string]interface{}{
-			"message": fmt.Sprintf("Error while handling cloud message: %s", err),
-		})
-		return
+		log.Error().Err(err).Str("message_id", message.ID).Msg("Error while handling cloud message")
 	}
 
-	jsonResponse(w, http.StatusOK, map[string]interface{}{
-		"message": "Message event processed successfully",
-	})
-	return
+	return err
+}
+
+// findMessageContact returns the contact that sent the message. Meta sends the contacts in the
+// same order as the messages, so the index is used when the WhatsApp ID doesn't match.
+func findMessageContact(
+	contacts []types.CloudContact, index int, message types.CloudMessage,
+) *types.CloudContact {
+	for i := range contacts {
+		if contacts[i].WaID == message.From {
+			return &contacts[i]
+		}
+	}
+
+	if index < len(contacts) {
+		return &contacts[index]
+	}
+
+	return nil
 }
 
 func verifyConnection(w http.ResponseWriter, r *http.Request) {
@@ -137,7 +346,17 @@ func verifyConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if token != brmain.Config.Provisioning.SharedSecret {
+	validToken, err := isValidVerifyToken(r.Context(), mux.Vars(r)["app"], token)
+
+	if err != nil {
+		hlog.FromRequest(r).Error().Err(err).Msg("Error while validating verification token")
+		jsonResponse(w, http.StatusOK, map[string]interface{}{
+			"message": "Error while validating verification token",
+		})
+		return
+	}
+
+	if !validToken {
 		hlog.FromRequest(r).Info().Msg("Invalid verification token... returning error")
 		hlog.FromRequest(r).Error().Msg("Invalid verification token")
 		jsonResponse(w, http.StatusOK, map[string]interface{}{